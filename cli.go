@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// exit codes of commands
+const (
+	exitOK = 0
+	// exitError means the source or the storage failed
+	exitError = 1
+	// exitUsage means arguments, the token or the dir are wrong
+	exitUsage = 2
+	// exitAuth means the source rejected the token
+	exitAuth = 3
+	// exitPartial means the job is finished but some photos are not saved
+	exitPartial = 4
+	// exitInterrupted means the job is canceled by a signal
+	exitInterrupted = 130
+)
+
+// tokenEnv keeps a token of any source, a token of a particular source is kept by PHOTODUMPER_<SOURCE>_TOKEN
+const tokenEnv = "PHOTODUMPER_TOKEN"
+
+const commandsUsage = `  albums --source vk                                 list albums
+  download --source vk --album 123 --dir ~/dump      download an album
+  download-all --source vk --dir ~/dump              download all albums
+Commands read the token from --token-file, PHOTODUMPER_<SOURCE>_TOKEN or ` + tokenEnv + `.
+Exit codes: 0 ok, 1 error, 2 wrong usage, 3 token is rejected, 4 some photos failed, 130 interrupted.
+`
+
+// usage describes options and commands of the app
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [command]\n\nThe server is started unless a command is given:\n%s\nOptions:\n", os.Args[0], commandsUsage)
+	flag.PrintDefaults()
+}
+
+// commandRoots returns -roots of flags if it is given explicitly, otherwise commands may save photos to any dir.
+// The default roots protect the server from web pages, a command is run by the user on their own.
+func commandRoots(flags *flag.FlagSet) string {
+	list := ""
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "roots" {
+			list = f.Value.String()
+		}
+	})
+	return list
+}
+
+// runCommand runs the command of args without the server, progress goes to stdout and errors go to stderr.
+// It returns an exit code.
+func runCommand(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	name := args[0]
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	sourceName := flags.String("source", "", "source name, e.g. vk or instagram")
+	tokenFile := flags.String("token-file", "", "file with the token of the source")
+	var album, dir *string
+	switch name {
+	case "albums":
+	case "download":
+		album = flags.String("album", "", "album ID")
+		dir = flags.String("dir", "", "directory where photos will be stored")
+	case "download-all":
+		dir = flags.String("dir", "", "directory where photos will be stored")
+	default:
+		fmt.Fprintf(stderr, "command %q is unknown\n%s", name, commandsUsage)
+		return exitUsage
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	switch {
+	case *sourceName == "":
+		fmt.Fprintln(stderr, "please provide --source")
+		return exitUsage
+	case album != nil && *album == "":
+		fmt.Fprintln(stderr, "please provide --album")
+		return exitUsage
+	case dir != nil && *dir == "":
+		fmt.Fprintln(stderr, "please provide --dir")
+		return exitUsage
+	}
+	token, err := readToken(*sourceName, *tokenFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	social, err := sources.New(*sourceName, token)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	var job *sources.Job
+	switch name {
+	case "albums":
+		return printAlbums(social, stdout, stderr)
+	case "download":
+		job, err = social.DownloadAlbum(ctx, *album, *dir)
+	case "download-all":
+		job, err = social.DownloadAllAlbums(ctx, *dir)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	return followJob(ctx, job, stdout)
+}
+
+// readToken reads the token of the source from the file or from the environment
+func readToken(sourceName, file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("token file %q is empty", file)
+	}
+	sourceEnv := "PHOTODUMPER_" + strings.ToUpper(sourceName) + "_TOKEN"
+	for _, name := range []string{sourceEnv, tokenEnv} {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("token of %s is not found, set %s, %s or --token-file", sourceName, sourceEnv, tokenEnv)
+}
+
+// fail prints the error of a failed command and returns an exit code
+func fail(stderr io.Writer, err error) int {
+	var e *sources.AccessError
+	switch {
+	case errors.As(err, &e):
+		fmt.Fprintln(stderr, err)
+		return exitAuth
+	case errors.Is(err, sources.ErrDirInvalid), errors.Is(err, sources.ErrDirNotAllowed):
+		fmt.Fprintln(stderr, dirError(err))
+		return exitUsage
+	}
+	fmt.Fprintln(stderr, err)
+	return exitError
+}
+
+// printAlbums prints IDs and titles of albums separated by tabs
+func printAlbums(social *sources.Social, stdout, stderr io.Writer) int {
+	albums, err := social.Albums()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	for _, album := range albums {
+		if album == nil {
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", album["id"], album["title"])
+	}
+	return exitOK
+}
+
+// followJob prints events of the job until it is finished, the job is canceled with ctx
+func followJob(ctx context.Context, job *sources.Job, stdout io.Writer) int {
+	done := ctx.Done()
+	last := 0
+	for {
+		events, changed := job.EventsAfter(last)
+		for _, event := range events {
+			last = event.ID
+			switch event.Type {
+			case sources.EventAlbumStarted:
+				fmt.Fprintf(stdout, "album %q is started\n", event.Album)
+			case sources.EventPhotoSaved:
+				fmt.Fprintf(stdout, "saved %s\n", event.Path)
+			case sources.EventPhotoFailed:
+				fmt.Fprintf(stdout, "failed %s of %q at %s: %s\n", event.PhotoID, event.Album, event.Stage, event.Error)
+			case sources.EventAlbumFailed:
+				fmt.Fprintf(stdout, "failed album %q at %s: %s\n", event.Album, event.Stage, event.Error)
+			case sources.EventJobFinished:
+				return summary(job.Info(), stdout)
+			}
+		}
+		select {
+		case <-changed:
+		case <-done:
+			fmt.Fprintln(stdout, "canceling...")
+			// the job is canceled by ctx, its last event is still awaited
+			done = nil
+		}
+	}
+}
+
+// summary prints counters of the finished job and returns the exit code
+func summary(info sources.JobInfo, stdout io.Writer) int {
+	fmt.Fprintf(stdout, "%s: %d downloaded, %d failed, %d skipped, %d filtered, %d canceled, %d bytes in %s\n",
+		info.Status, info.Downloaded, info.Failed, info.Skipped, info.Filtered, info.Canceled, info.Bytes, info.Dir)
+	switch {
+	case info.Status == sources.JobCanceled:
+		return exitInterrupted
+	case info.Failed > 0:
+		return exitPartial
+	}
+	return exitOK
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPhoto struct {
+	id string
+}
+
+func (p *testPhoto) ID() string {
+	return p.id
+}
+
+func (p *testPhoto) Url() string {
+	return "https://example.com/" + p.id + ".jpg"
+}
+
+func (p *testPhoto) AlbumID() string {
+	return "1"
+}
+
+func (p *testPhoto) AlbumName() string {
+	return "album"
+}
+
+func (p *testPhoto) ExifInfo() (sources.ExifInfo, error) {
+	return nil, errors.New("no exif")
+}
+
+func Test_runCommand(t *testing.T) {
+	t.Setenv(tokenEnv, "")
+	t.Setenv("PHOTODUMPER_TEST_TOKEN", "sdfsdf")
+	albums := []map[string]string{{"id": "1", "title": "first"}, nil, {"id": "2", "title": "second"}}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name       string
+		args       []string
+		ctx        context.Context
+		service    *service
+		storage    *storage
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "unknown command", args: []string{"upload"}, wantCode: exitUsage, wantStderr: `command "upload" is unknown`},
+		{name: "unknown flag", args: []string{"albums", "--album", "1"}, wantCode: exitUsage, wantStderr: "flag provided but not defined"},
+		{name: "help", args: []string{"download", "-h"}, wantCode: exitOK, wantStderr: "-album"},
+		{name: "no source", args: []string{"albums"}, wantCode: exitUsage, wantStderr: "please provide --source"},
+		{name: "no album", args: []string{"download", "--source", "test", "--dir", "dump"}, wantCode: exitUsage, wantStderr: "please provide --album"},
+		{name: "no dir", args: []string{"download-all", "--source", "test"}, wantCode: exitUsage, wantStderr: "please provide --dir"},
+		{name: "unknown source", args: []string{"albums", "--source", "test1"}, wantCode: exitUsage, wantStderr: "PHOTODUMPER_TEST1_TOKEN"},
+		{name: "albums", args: []string{"albums", "--source", "test"}, service: &service{albums: albums}, wantCode: exitOK, wantStdout: "1\tfirst\n2\tsecond\n"},
+		{name: "rejected token", args: []string{"albums", "--source", "test"}, service: &service{sourceError: &sources.AccessError{Text: "token is expired"}}, wantCode: exitAuth, wantStderr: "token is expired"},
+		{name: "download", args: []string{"download", "--source", "test", "--album", "1", "--dir", "dump"}, wantCode: exitOK, wantStdout: "finished: 0 downloaded, 0 failed"},
+		{name: "download all", args: []string{"download-all", "--source", "test", "--dir", "dump"}, service: &service{albums: albums[:1]}, wantCode: exitOK, wantStdout: "finished: 0 downloaded"},
+		{name: "storage error", args: []string{"download", "--source", "test", "--album", "1", "--dir", "dump"}, storage: &storage{err: errors.New("bad")}, wantCode: exitError, wantStderr: "dir can't be created"},
+		{name: "dir outside of roots", args: []string{"download", "--source", "test", "--album", "1", "--dir", "/etc"}, storage: &storage{err: fmt.Errorf("/etc: %w", sources.ErrDirNotAllowed)}, wantCode: exitUsage, wantStderr: "/etc: dir is outside of allowed roots"},
+		{
+			name:       "failed photos",
+			args:       []string{"download", "--source", "test", "--album", "1", "--dir", "dump"},
+			service:    &service{photos: []sources.Photo{&testPhoto{id: "7"}}},
+			storage:    &storage{downloadPhotoErr: errors.New("broken")},
+			wantCode:   exitPartial,
+			wantStdout: `failed 7 of "album" at download: broken`,
+		},
+		{
+			name:       "failed album",
+			args:       []string{"download-all", "--source", "test", "--dir", "dump"},
+			service:    &service{albums: albums[:1], albumError: errors.New("too many requests")},
+			wantCode:   exitPartial,
+			wantStdout: `failed album "first" at album_photos: too many requests`,
+		},
+		{name: "interrupted", args: []string{"download", "--source", "test", "--album", "1", "--dir", "dump"}, ctx: canceled, service: &service{photos: []sources.Photo{&testPhoto{id: "7"}}}, wantCode: exitInterrupted, wantStdout: "canceled:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.service == nil {
+				tt.service = &service{}
+			}
+			if tt.storage == nil {
+				tt.storage = &storage{}
+			}
+			if tt.ctx == nil {
+				tt.ctx = context.Background()
+			}
+			sources.AddSource(tt.service)
+			sources.AddStorage(tt.storage)
+			var stdout, stderr bytes.Buffer
+
+			code := runCommand(tt.ctx, tt.args, &stdout, &stderr)
+			assert.Equal(t, tt.wantCode, code, stderr.String())
+			assert.Contains(t, stdout.String(), tt.wantStdout)
+			assert.Contains(t, stderr.String(), tt.wantStderr)
+		})
+	}
+}
+
+func Test_commandRoots(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "default", args: []string{"download"}, want: ""},
+		{name: "explicit", args: []string{"-roots", "~/Pictures", "download"}, want: "~/Pictures"},
+		{name: "explicit default", args: []string{"-roots", "~", "download"}, want: "~"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("photoDumper", flag.ContinueOnError)
+			flags.String("roots", "~", "")
+			assert.NoError(t, flags.Parse(tt.args))
+			assert.Equal(t, tt.want, commandRoots(flags))
+		})
+	}
+}
+
+func Test_readToken(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0600))
+	empty := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(empty, []byte("\n"), 0600))
+	t.Setenv(tokenEnv, "common")
+	t.Setenv("PHOTODUMPER_VK_TOKEN", "vk")
+	t.Setenv("PHOTODUMPER_INSTAGRAM_TOKEN", "")
+
+	tests := []struct {
+		name    string
+		source  string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "file", source: "vk", file: file, want: "from-file"},
+		{name: "empty file", source: "vk", file: empty, wantErr: true},
+		{name: "missing file", source: "vk", file: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "source env", source: "vk", want: "vk"},
+		{name: "common env", source: "instagram", want: "common"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readToken(tt.source, tt.file)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Package docs GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
+// Package docs GENERATED BY SWAG; DO NOT EDIT
 // This file was generated by swaggo/swag
 package docs
 
@@ -91,7 +91,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "download all photos of particular album, returns destination of your photos",
+                "description": "download all photos of particular album, returns destination of your photos and job ID or a plan if dry_run is set",
                 "consumes": [
                     "application/json"
                 ],
@@ -120,6 +120,48 @@ const docTemplate = `{
                         "name": "dir",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "returns a plan of the download without writing anything",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download photos created at or after, RFC3339 or 2006-01-02",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download photos created before, RFC3339 or 2006-01-02",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download only image or video",
+                        "name": "media_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum width, photos of unknown resolution are skipped",
+                        "name": "min_width",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum height, photos of unknown resolution are skipped",
+                        "name": "min_height",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "download only photos with location",
+                        "name": "has_gps",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -166,7 +208,7 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "download all photos of all albums, returns destination of your photos",
+                "description": "download all photos of all albums, returns destination of your photos and job ID or a plan if dry_run is set",
                 "consumes": [
                     "application/json"
                 ],
@@ -188,6 +230,48 @@ const docTemplate = `{
                         "name": "dir",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "returns a plan of the download without writing anything",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download photos created at or after, RFC3339 or 2006-01-02",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download photos created before, RFC3339 or 2006-01-02",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "download only image or video",
+                        "name": "media_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum width, photos of unknown resolution are skipped",
+                        "name": "min_width",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "minimum height, photos of unknown resolution are skipped",
+                        "name": "min_height",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "download only photos with location",
+                        "name": "has_gps",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -227,6 +311,420 @@ const docTemplate = `{
                 }
             }
         },
+        "/jobs/": {
+            "get": {
+                "description": "returns state of all download jobs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Jobs",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sources.JobInfo"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/": {
+            "get": {
+                "description": "returns state of a download job",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/sources.JobInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/cancel/": {
+            "post": {
+                "description": "stops a download job, photos which are not downloaded yet are counted as canceled",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Cancel job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/sources.JobInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/events/": {
+            "get": {
+                "description": "streams progress events of a download job as Server-Sent Events: album_started, photo_saved, photo_failed, album_failed and job_finished. Past events are sent first, Last-Event-ID skips the ones which are already received. The stream ends with job_finished.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Job events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the last received event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sources.Event"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/failed/": {
+            "get": {
+                "description": "returns photos of a download job which failed at some stage",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Failed items",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sources.FailedItem"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/metadata/": {
+            "get": {
+                "description": "tells for every saved photo of a download job whether its metadata is embedded into the file or written to a sidecar",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Metadata outcomes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sources.MetadataResult"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/pause/": {
+            "post": {
+                "description": "suspends a download job until it is resumed or canceled",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Pause job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/sources.JobInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/resume/": {
+            "post": {
+                "description": "continues a paused download job",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Resume job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/sources.JobInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/retry/": {
+            "post": {
+                "description": "downloads photos of a finished job which are not saved again, returns destination of your photos and ID of a new job",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Retry failed items",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/session/": {
+            "delete": {
+                "description": "forgets tokens of the session and clears the session cookie",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete session",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/session/{sourceName}/": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "exchanges a token of the source given by the Authorization header for a session cookie, so the token is not sent again. Tokens of several sources share the session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "source name",
+                        "name": "sourceName",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/sources/": {
             "get": {
                 "description": "returns sources",
@@ -251,18 +749,197 @@ const docTemplate = `{
             }
         }
     },
+    "definitions": {
+        "sources.AlbumStats": {
+            "type": "object",
+            "properties": {
+                "downloaded": {
+                    "type": "integer"
+                },
+                "duplicates": {
+                    "description": "Duplicates is a number of downloaded photos which have the same content as already saved ones",
+                    "type": "integer"
+                }
+            }
+        },
+        "sources.Event": {
+            "type": "object",
+            "properties": {
+                "album": {
+                    "type": "string"
+                },
+                "album_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID is a sequence number of the event within the job, it starts with 1",
+                    "type": "integer"
+                },
+                "job_id": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "photo_id": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "stage": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "sources.FailedItem": {
+            "type": "object",
+            "properties": {
+                "album": {
+                    "type": "string"
+                },
+                "album_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "fatal": {
+                    "description": "Fatal means the photo is not saved, otherwise it is saved without a later stage, e.g. its exif.\nOnly fatal items are retried.",
+                    "type": "boolean"
+                },
+                "photo_id": {
+                    "type": "string"
+                },
+                "stage": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "sources.JobInfo": {
+            "type": "object",
+            "properties": {
+                "albums": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/sources.AlbumStats"
+                    }
+                },
+                "bytes": {
+                    "type": "integer"
+                },
+                "canceled": {
+                    "description": "Canceled is a number of queued photos which are not saved because the job is canceled",
+                    "type": "integer"
+                },
+                "dir": {
+                    "type": "string"
+                },
+                "downloaded": {
+                    "type": "integer"
+                },
+                "duplicates": {
+                    "description": "Duplicates is a number of downloaded photos which have the same content as already saved ones",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "Failed is a number of photos which are not saved and albums which photos can't be received",
+                    "type": "integer"
+                },
+                "failed_items": {
+                    "description": "FailedItems is a number of failed items, see Job.Failures. It counts both photos which are not saved\nand saved photos with a failed stage, e.g. set_exif, so it may be greater than Failed.",
+                    "type": "integer"
+                },
+                "filtered": {
+                    "description": "Filtered is a number of photos which don't match the filter",
+                    "type": "integer"
+                },
+                "finished": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "description": "Metadata counts saved photos by outcomes of saving their metadata, see Job.Metadata",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Skipped is a number of photos which are already saved or have no url",
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "started": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "sources.MetadataResult": {
+            "type": "object",
+            "properties": {
+                "album": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error tells why metadata is not embedded into the file",
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "photo_id": {
+                    "type": "string"
+                }
+            }
+        }
+    },
     "securityDefinitions": {
         "ApiKeyAuth": {
             "type": "apiKey",
-            "name": "api_key",
-            "in": "query"
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
 
 // SwaggerInfo holds exported Swagger Info so clients can modify it
 var SwaggerInfo = &swag.Spec{
-	Version:          "1.1.2",
+	Version:          "1.2.0",
 	Host:             "localhost:8080",
 	BasePath:         "/api/",
 	Schemes:          []string{},
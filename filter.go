@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// parseFilter builds a filter of downloads from parameters returned by get:
+// created_after, created_before (RFC3339 or 2006-01-02), media_type (image or video),
+// min_width, min_height and has_gps
+func parseFilter(get func(key string) string) (*sources.Filter, error) {
+	var (
+		filter = &sources.Filter{}
+		err    error
+	)
+	if filter.CreatedAfter, err = parseTime(get("created_after")); err != nil {
+		return nil, fmt.Errorf("created_after: %w", err)
+	}
+	if filter.CreatedBefore, err = parseTime(get("created_before")); err != nil {
+		return nil, fmt.Errorf("created_before: %w", err)
+	}
+	switch mediaType := get("media_type"); mediaType {
+	case "", sources.MediaImage, sources.MediaVideo:
+		filter.MediaType = mediaType
+	default:
+		return nil, fmt.Errorf("media_type: %q is neither %s nor %s", mediaType, sources.MediaImage, sources.MediaVideo)
+	}
+	if filter.MinWidth, err = parseInt(get("min_width")); err != nil {
+		return nil, fmt.Errorf("min_width: %w", err)
+	}
+	if filter.MinHeight, err = parseInt(get("min_height")); err != nil {
+		return nil, fmt.Errorf("min_height: %w", err)
+	}
+	if value := get("has_gps"); value != "" {
+		if filter.HasGPS, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("has_gps: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
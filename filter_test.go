@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   map[string]string
+		want    *sources.Filter
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			query: map[string]string{},
+			want:  &sources.Filter{},
+		},
+		{
+			name: "all",
+			query: map[string]string{
+				"created_after":  "2022-01-02T03:04:05Z",
+				"created_before": "2023-01-01",
+				"media_type":     "video",
+				"min_width":      "800",
+				"min_height":     "600",
+				"has_gps":        "true",
+			},
+			want: &sources.Filter{
+				CreatedAfter:  time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+				CreatedBefore: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+				MediaType:     sources.MediaVideo,
+				MinWidth:      800,
+				MinHeight:     600,
+				HasGPS:        true,
+			},
+		},
+		{name: "bad date", query: map[string]string{"created_after": "yesterday"}, wantErr: true},
+		{name: "bad before", query: map[string]string{"created_before": "2023-13-01"}, wantErr: true},
+		{name: "bad media type", query: map[string]string{"media_type": "audio"}, wantErr: true},
+		{name: "bad width", query: map[string]string{"min_width": "wide"}, wantErr: true},
+		{name: "bad height", query: map[string]string{"min_height": "high"}, wantErr: true},
+		{name: "bad gps", query: map[string]string{"has_gps": "maybe"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFilter(func(key string) string { return tt.query[key] })
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.True(t, tt.want.CreatedAfter.Equal(got.CreatedAfter))
+				assert.True(t, tt.want.CreatedBefore.Equal(got.CreatedBefore))
+				tt.want.CreatedAfter, tt.want.CreatedBefore = got.CreatedAfter, got.CreatedBefore
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Gasoid/photoDumper/sources"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
+// eventsKeepAlive is an interval of comments sent to an idle event stream, so proxies don't close it
+const eventsKeepAlive = 15 * time.Second
+
 // sourcesHandler godoc
 // @Summary      Sources
 // @Description  returns sources
@@ -24,28 +31,23 @@ func sourcesHandler(c *gin.Context) {
 // @Description  returns albums
 // @Produce      json
 // @Accept       json
-// @Param        sourceName  path     string  true  "source name"
-// @Success      200         {array}  string
-// @Failure      400         {string}  string    "error"
-// @Failure      401         {string}  string    "error"
-// @Failure      403         {string}  string    "error"
-// @Failure      500         {string}  string    "error"
+// @Param        sourceName  path      string  true  "source name"
+// @Success      200         {array}   string
+// @Failure      400         {string}  string  "error"
+// @Failure      401         {string}  string  "error"
+// @Failure      403         {string}  string  "error"
+// @Failure      500         {string}  string  "error"
 // @Security     ApiKeyAuth
 // @Router       /albums/{sourceName}/ [get]
 func albumsHandler(c *gin.Context) {
-	source, err := sources.New(c.Param("sourceName"), c.Query("api_key"))
+	source, err := sources.New(c.Param("sourceName"), sourceToken(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	albums, err := source.Albums()
 	if err != nil {
-		var e *sources.AccessError
-		if errors.As(err, &e) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		sourceError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"albums": albums})
@@ -53,67 +55,318 @@ func albumsHandler(c *gin.Context) {
 
 // downloadAlbumHandler godoc
 // @Summary      download photos of album
-// @Description  download all photos of particular album, returns destination of your photos
+// @Description  download all photos of particular album, returns destination of your photos and job ID or a plan if dry_run is set
 // @Produce      json
 // @Accept       json
-// @Param        sourceName  path     string  true  "source name"
-// @Param        albumID     path     string  true  "album ID"
-// @Param        dir         query    string  true  "directory where photos will be stored"
-// @Success      200         {array}  string
-// @Failure      400         {string}  string    "error"
-// @Failure      401         {string}  string    "error"
-// @Failure      403         {string}  string    "error"
-// @Failure      500         {string}  string    "error"
+// @Param        sourceName      path      string  true   "source name"
+// @Param        albumID         path      string  true   "album ID"
+// @Param        dir             query     string  true   "directory where photos will be stored"
+// @Param        dry_run         query     bool    false  "returns a plan of the download without writing anything"
+// @Param        created_after   query     string  false  "download photos created at or after, RFC3339 or 2006-01-02"
+// @Param        created_before  query     string  false  "download photos created before, RFC3339 or 2006-01-02"
+// @Param        media_type      query     string  false  "download only image or video"
+// @Param        min_width       query     int     false  "minimum width, photos of unknown resolution are skipped"
+// @Param        min_height      query     int     false  "minimum height, photos of unknown resolution are skipped"
+// @Param        has_gps         query     bool    false  "download only photos with location"
+// @Success      200             {array}   string
+// @Failure      400             {string}  string  "error"
+// @Failure      401             {string}  string  "error"
+// @Failure      403             {string}  string  "error"
+// @Failure      500             {string}  string  "error"
 // @Router       /download-album/{albumID}/{sourceName}/ [get]
 // @Security     ApiKeyAuth
 func downloadAlbumHandler(c *gin.Context) {
-	source, err := sources.New(c.Param("sourceName"), c.Query("api_key"))
+	source, err := sources.New(c.Param("sourceName"), sourceToken(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	dir, err := source.DownloadAlbum(c.Param("albumID"), c.Query("dir"))
+	filter, err := parseFilter(c.Query)
 	if err != nil {
-		var e *sources.AccessError
-		if errors.As(err, &e) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	source.SetFilter(filter)
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		plan, err := source.PlanAlbum(c.Request.Context(), c.Param("albumID"), c.Query("dir"))
+		if err != nil {
+			sourceError(c, err)
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"dir": plan.Dir, "plan": plan, "error": ""})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"dir": dir, "error": ""})
+	job, err := source.DownloadAlbum(jobContext(c), c.Param("albumID"), c.Query("dir"))
+	if err != nil {
+		sourceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dir": job.Dir, "job": job.ID, "error": ""})
 }
 
 // downloadAllAlbumsHandler godoc
 // @Summary      download photos of albums
-// @Description  download all photos of all albums, returns destination of your photos
+// @Description  download all photos of all albums, returns destination of your photos and job ID or a plan if dry_run is set
 // @Produce      json
 // @Accept       json
-// @Param        sourceName  path     string  true  "source name"
-// @Param        dir         query    string  true  "directory where photos will be stored"
-// @Success      200         {array}  string
-// @Failure      400         {string}  string    "error"
-// @Failure      401         {string}  string    "error"
-// @Failure      403         {string}  string    "error"
-// @Failure      500         {string}  string    "error"
+// @Param        sourceName      path      string  true   "source name"
+// @Param        dir             query     string  true   "directory where photos will be stored"
+// @Param        dry_run         query     bool    false  "returns a plan of the download without writing anything"
+// @Param        created_after   query     string  false  "download photos created at or after, RFC3339 or 2006-01-02"
+// @Param        created_before  query     string  false  "download photos created before, RFC3339 or 2006-01-02"
+// @Param        media_type      query     string  false  "download only image or video"
+// @Param        min_width       query     int     false  "minimum width, photos of unknown resolution are skipped"
+// @Param        min_height      query     int     false  "minimum height, photos of unknown resolution are skipped"
+// @Param        has_gps         query     bool    false  "download only photos with location"
+// @Success      200             {array}   string
+// @Failure      400             {string}  string  "error"
+// @Failure      401             {string}  string  "error"
+// @Failure      403             {string}  string  "error"
+// @Failure      500             {string}  string  "error"
 // @Router       /download-all-albums/{sourceName}/ [get]
 // @Security     ApiKeyAuth
 func downloadAllAlbumsHandler(c *gin.Context) {
-	source, err := sources.New(c.Param("sourceName"), c.Query("api_key"))
+	source, err := sources.New(c.Param("sourceName"), sourceToken(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	dir, err := source.DownloadAllAlbums(c.Query("dir"))
+	filter, err := parseFilter(c.Query)
 	if err != nil {
-		var e *sources.AccessError
-		if errors.As(err, &e) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	source.SetFilter(filter)
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		plan, err := source.PlanAllAlbums(c.Request.Context(), c.Query("dir"))
+		if err != nil {
+			sourceError(c, err)
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"dir": plan.Dir, "plan": plan, "error": ""})
+		return
+	}
+	job, err := source.DownloadAllAlbums(jobContext(c), c.Query("dir"))
+	if err != nil {
+		sourceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dir": job.Dir, "job": job.ID, "error": ""})
+}
+
+// sourceError responds with 401 if the source rejected credentials, with 400 or 403 if the destination dir
+// is invalid or not allowed, otherwise with 500
+func sourceError(c *gin.Context, err error) {
+	var e *sources.AccessError
+	switch {
+	case errors.As(err, &e):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, sources.ErrDirInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": dirError(err)})
+	case errors.Is(err, sources.ErrDirNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": dirError(err)})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// dirError returns a message of the storage, it tells what is wrong with the dir
+func dirError(err error) string {
+	var e *sources.StorageError
+	if errors.As(err, &e) && e.Unwrap() != nil {
+		return e.Unwrap().Error()
+	}
+	return err.Error()
+}
+
+// jobContext returns a context for a download job, the job outlives the request
+// so the request cancellation is not propagated
+func jobContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// jobsHandler godoc
+// @Summary      Jobs
+// @Description  returns state of all download jobs
+// @Produce      json
+// @Accept       json
+// @Success      200  {array}  sources.JobInfo
+// @Router       /jobs/ [get]
+func jobsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": sources.Jobs()})
+}
+
+// jobHandler godoc
+// @Summary      Job
+// @Description  returns state of a download job
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {object}  sources.JobInfo
+// @Failure      404    {string}  string  "error"
+// @Router       /jobs/{jobID}/ [get]
+func jobHandler(c *gin.Context) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": job.Info()})
+}
+
+// cancelJobHandler godoc
+// @Summary      Cancel job
+// @Description  stops a download job, photos which are not downloaded yet are counted as canceled
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {object}  sources.JobInfo
+// @Failure      404    {string}  string  "error"
+// @Failure      409    {string}  string  "error"
+// @Router       /jobs/{jobID}/cancel/ [post]
+func cancelJobHandler(c *gin.Context) {
+	jobAction(c, (*sources.Job).Cancel)
+}
+
+// pauseJobHandler godoc
+// @Summary      Pause job
+// @Description  suspends a download job until it is resumed or canceled
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {object}  sources.JobInfo
+// @Failure      404    {string}  string  "error"
+// @Failure      409    {string}  string  "error"
+// @Router       /jobs/{jobID}/pause/ [post]
+func pauseJobHandler(c *gin.Context) {
+	jobAction(c, (*sources.Job).Pause)
+}
+
+// resumeJobHandler godoc
+// @Summary      Resume job
+// @Description  continues a paused download job
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {object}  sources.JobInfo
+// @Failure      404    {string}  string  "error"
+// @Failure      409    {string}  string  "error"
+// @Router       /jobs/{jobID}/resume/ [post]
+func resumeJobHandler(c *gin.Context) {
+	jobAction(c, (*sources.Job).Resume)
+}
+
+// failedItemsHandler godoc
+// @Summary      Failed items
+// @Description  returns photos of a download job which failed at some stage
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {array}   sources.FailedItem
+// @Failure      404    {string}  string  "error"
+// @Router       /jobs/{jobID}/failed/ [get]
+func failedItemsHandler(c *gin.Context) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"failed": job.Failures()})
+}
+
+// metadataHandler godoc
+// @Summary      Metadata outcomes
+// @Description  tells for every saved photo of a download job whether its metadata is embedded into the file or written to a sidecar
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {array}   sources.MetadataResult
+// @Failure      404    {string}  string  "error"
+// @Router       /jobs/{jobID}/metadata/ [get]
+func metadataHandler(c *gin.Context) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"metadata": job.Metadata()})
+}
+
+// eventsHandler godoc
+// @Summary      Job events
+// @Description  streams progress events of a download job as Server-Sent Events: album_started, photo_saved, photo_failed, album_failed and job_finished. Past events are sent first, Last-Event-ID skips the ones which are already received. The stream ends with job_finished.
+// @Produce      text/event-stream
+// @Param        jobID          path      string  true   "job ID"
+// @Param        Last-Event-ID  header    int     false  "ID of the last received event"
+// @Success      200            {array}   sources.Event
+// @Failure      404            {string}  string  "error"
+// @Router       /jobs/{jobID}/events/ [get]
+func eventsHandler(c *gin.Context) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	last, _ := strconv.Atoi(c.GetHeader("Last-Event-ID"))
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		events, changed := job.EventsAfter(last)
+		for _, event := range events {
+			c.Render(-1, sse.Event{Id: strconv.Itoa(event.ID), Event: event.Type, Data: event})
+			last = event.ID
+		}
+		c.Writer.Flush()
+		if len(events) > 0 && events[len(events)-1].Type == sources.EventJobFinished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			c.Writer.WriteString(":\n\n")
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// retryJobHandler godoc
+// @Summary      Retry failed items
+// @Description  downloads photos of a finished job which are not saved again, returns destination of your photos and ID of a new job
+// @Produce      json
+// @Accept       json
+// @Param        jobID  path      string  true  "job ID"
+// @Success      200    {array}   string
+// @Failure      404    {string}  string  "error"
+// @Failure      409    {string}  string  "error"
+// @Router       /jobs/{jobID}/retry/ [post]
+func retryJobHandler(c *gin.Context) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	retry, err := job.Retry()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dir": retry.Dir, "job": retry.ID, "error": ""})
+}
+
+func jobAction(c *gin.Context, action func(*sources.Job) error) {
+	job, ok := sources.GetJob(c.Param("jobID"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not found"})
+		return
+	}
+	if err := action(job); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"dir": dir, "error": ""})
+	c.JSON(http.StatusOK, gin.H{"job": job.Info()})
 }
@@ -1,65 +1,115 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Gasoid/photoDumper/sources"
 	"github.com/stretchr/testify/assert"
 )
 
 type StorageTest struct {
-	dir               string
-	err               error
-	albumdir          string
-	createalbumdirErr error
-	downloadPhoto     string
-	downloadPhotoErr  error
-	setExifErr        error
+	dir              string
+	err              error
+	photoPath        string
+	preparePhotoErr  error
+	downloadPhoto    *sources.File
+	downloadPhotoErr error
+	setExifErr       error
 }
 
 func (s *StorageTest) Prepare(dir string) (string, error) {
 	return s.dir, s.err
 }
 
-func (s *StorageTest) DownloadPhoto(photoUrl, dir string) (string, error) {
+func (s *StorageTest) DownloadPhoto(ctx context.Context, photoUrl, dir string) (*sources.File, error) {
 	return s.downloadPhoto, s.downloadPhotoErr
 }
 
-func (s *StorageTest) CreateAlbumDir(rootDir, dir string) (string, error) {
-	return s.albumdir, s.createalbumdirErr
+func (s *StorageTest) PreparePhoto(rootDir string, album sources.Album, photo sources.Photo) (string, error) {
+	return s.photoPath, s.preparePhotoErr
+}
+
+func (s *StorageTest) Deduplicate(rootDir string, file *sources.File) (*sources.File, error) {
+	return file, nil
+}
+
+func (s *StorageTest) WriteSidecar(filepath string, meta sources.Metadata, fallback bool) error {
+	return nil
 }
 
 func (s *StorageTest) SetExif(filepath string, data sources.ExifInfo) error {
 	return s.setExifErr
 }
 
+func (s *StorageTest) Saved(rootDir, source, photoID string) bool {
+	return false
+}
+
+func (s *StorageTest) Record(rootDir string, entry sources.ManifestEntry) error {
+	return nil
+}
+
+func (s *StorageTest) SaveReport(rootDir, name string, data []byte) error {
+	return nil
+}
+
+func (s *StorageTest) DirPath(dir string) (string, error) {
+	return s.dir, s.err
+}
+
+func (s *StorageTest) PlanPhoto(ctx context.Context, rootDir string, album sources.Album, photo sources.Photo) (*sources.PlannedFile, error) {
+	return &sources.PlannedFile{PhotoID: photo.ID(), AlbumDir: s.photoPath}, s.downloadPhotoErr
+}
+
 type SourceTest struct {
 	albums []map[string]string
+	photos []sources.Photo
 	err    error
+	// albumErr is an error of AlbumPhotos only
+	albumErr error
 }
 
 func (source *SourceTest) AllAlbums() ([]map[string]string, error) {
 	return source.albums, source.err
 }
 func (source *SourceTest) AlbumPhotos(albumdID string) (sources.ItemFetcher, error) {
-	return &testFetcher{}, source.err
+	if source.albumErr != nil {
+		return nil, source.albumErr
+	}
+	return &testFetcher{photos: source.photos}, source.err
 }
 
-type testFetcher struct{}
+type testFetcher struct {
+	photos []sources.Photo
+	item   sources.Photo
+}
 
 func (tf *testFetcher) Next() bool {
-	return false
+	if len(tf.photos) == 0 {
+		return false
+	}
+	tf.item, tf.photos = tf.photos[0], tf.photos[1:]
+	return true
 }
 
 func (tf *testFetcher) Item() sources.Photo {
-	return nil
+	return tf.item
 }
 
 type service struct {
 	sourceError error
+	albumError  error
+	albums      []map[string]string
+	photos      []sources.Photo
 }
 
 func (s *service) Kind() sources.Kind {
@@ -72,12 +122,13 @@ func (s *service) Key() string {
 
 func (s *service) Constructor() func(creds string) sources.Source {
 	return func(creds string) sources.Source {
-		return &SourceTest{err: s.sourceError}
+		return &SourceTest{err: s.sourceError, albumErr: s.albumError, albums: s.albums, photos: s.photos}
 	}
 }
 
 type storage struct {
-	err error
+	err              error
+	downloadPhotoErr error
 }
 
 func (s *storage) Kind() sources.Kind {
@@ -90,7 +141,7 @@ func (s *storage) Key() string {
 
 func (s *storage) Constructor() func() sources.Storage {
 	return func() sources.Storage {
-		return &StorageTest{err: s.err}
+		return &StorageTest{err: s.err, downloadPhotoErr: s.downloadPhotoErr}
 	}
 }
 
@@ -174,6 +225,34 @@ func Test_downloadAlbumStorageError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func Test_downloadDirErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		path     string
+		wantCode int
+	}{
+		{name: "album invalid dir", err: fmt.Errorf("../x: %w", sources.ErrDirInvalid), path: "/api/download-album/albumid/test/?api_key=sdfsdf&dir=../x", wantCode: http.StatusBadRequest},
+		{name: "album dir outside", err: fmt.Errorf("/etc: %w", sources.ErrDirNotAllowed), path: "/api/download-album/albumid/test/?api_key=sdfsdf&dir=/etc", wantCode: http.StatusForbidden},
+		{name: "all albums dir outside", err: fmt.Errorf("/etc: %w", sources.ErrDirNotAllowed), path: "/api/download-all-albums/test/?api_key=sdfsdf&dir=/etc", wantCode: http.StatusForbidden},
+		{name: "plan dir outside", err: fmt.Errorf("/etc: %w", sources.ErrDirNotAllowed), path: "/api/download-album/albumid/test/?api_key=sdfsdf&dir=/etc&dry_run=true", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources.AddSource(&service{})
+			sources.AddStorage(&storage{err: tt.err})
+			router := setupRouter()
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.JSONEq(t, fmt.Sprintf(`{"error": %q}`, tt.err.Error()), w.Body.String())
+		})
+	}
+}
+
 func Test_downloadAlbumError(t *testing.T) {
 	sources.AddSource(&service{sourceError: &sources.AccessError{}})
 	sources.AddStorage(&storage{err: errors.New("bad")})
@@ -269,3 +348,225 @@ func Test_downloadAllAlbumsApiKeyError(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func Test_jobs(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-all-albums/test/?api_key=sdfsdf", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Job string `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Job)
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/jobs/", nil)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Contains(t, w2.Body.String(), resp.Job)
+
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodGet, "/api/jobs/"+resp.Job+"/", nil)
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusOK, w3.Code)
+	assert.Contains(t, w3.Body.String(), resp.Job)
+}
+
+func Test_jobNotFound(t *testing.T) {
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/jobs/nonExistent/", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_jobActions(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-all-albums/test/?api_key=sdfsdf", nil)
+	router.ServeHTTP(w, req)
+	var resp struct {
+		Job string `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "not found", path: "/api/jobs/nonExistent/cancel/", wantCode: http.StatusNotFound},
+		{name: "finished", path: "/api/jobs/" + resp.Job + "/pause/", wantCode: http.StatusConflict},
+		{name: "cancel finished", path: "/api/jobs/" + resp.Job + "/cancel/", wantCode: http.StatusConflict},
+		{name: "resume finished", path: "/api/jobs/" + resp.Job + "/resume/", wantCode: http.StatusConflict},
+		{name: "nothing to retry", path: "/api/jobs/" + resp.Job + "/retry/", wantCode: http.StatusConflict},
+		{name: "retry not found", path: "/api/jobs/nonExistent/retry/", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tt.path, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func Test_failedItems(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-album/albumid/test/?api_key=sdfsdf", nil)
+	router.ServeHTTP(w, req)
+	var resp struct {
+		Job string `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/jobs/"+resp.Job+"/failed/", nil)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.JSONEq(t, `{"failed":[]}`, w2.Body.String())
+
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodGet, "/api/jobs/nonExistent/failed/", nil)
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusNotFound, w3.Code)
+}
+
+func Test_metadata(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-album/albumid/test/?api_key=sdfsdf", nil)
+	router.ServeHTTP(w, req)
+	var resp struct {
+		Job string `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/jobs/"+resp.Job+"/metadata/", nil)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.JSONEq(t, `{"metadata":[]}`, w2.Body.String())
+
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodGet, "/api/jobs/nonExistent/metadata/", nil)
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusNotFound, w3.Code)
+}
+
+func Test_events(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-album/albumid/test/?api_key=sdfsdf", nil)
+	router.ServeHTTP(w, req)
+	var resp struct {
+		Job string `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	job, ok := sources.GetJob(resp.Job)
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		return job.Info().Finished != nil
+	}, time.Second, 10*time.Millisecond)
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/jobs/"+resp.Job+"/events/", nil)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, "text/event-stream", w2.Header().Get("Content-Type"))
+	assert.Contains(t, w2.Body.String(), "event:job_finished\n")
+
+	// events which are already received are skipped
+	events, _ := job.EventsAfter(0)
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodGet, "/api/jobs/"+resp.Job+"/events/", nil)
+	req3.Header.Set("Last-Event-ID", strconv.Itoa(len(events)-1))
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, fmt.Sprintf("id:%d\nevent:job_finished\n", len(events)), w3.Body.String()[:strings.Index(w3.Body.String(), "data:")])
+
+	w4 := httptest.NewRecorder()
+	req4, _ := http.NewRequest(http.MethodGet, "/api/jobs/nonExistent/events/", nil)
+	router.ServeHTTP(w4, req4)
+	assert.Equal(t, http.StatusNotFound, w4.Code)
+}
+
+func Test_downloadDryRun(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "album", path: "/api/download-album/albumid/test/?api_key=sdfsdf&dry_run=true", wantCode: http.StatusOK},
+		{name: "all albums", path: "/api/download-all-albums/test/?api_key=sdfsdf&dry_run=1", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			var resp struct {
+				Job  string        `json:"job"`
+				Plan *sources.Plan `json:"plan"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Empty(t, resp.Job)
+			assert.NotNil(t, resp.Plan)
+		})
+	}
+}
+
+func Test_downloadDryRunError(t *testing.T) {
+	sources.AddSource(&service{sourceError: &sources.AccessError{}})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/download-all-albums/test/?api_key=sdfsdf&dry_run=true", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/download-album/albumid/test/?api_key=sdfsdf&dry_run=true", nil)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusUnauthorized, w2.Code)
+}
+
+func Test_downloadBadFilter(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+	for _, path := range []string{
+		"/api/download-album/albumid/test/?api_key=sdfsdf&media_type=audio",
+		"/api/download-all-albums/test/?api_key=sdfsdf&min_width=wide",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
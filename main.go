@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	_ "github.com/Gasoid/photoDumper/docs"
@@ -24,6 +32,19 @@ var (
 	staticAssets    embed.FS
 	setupRouterFunc func() engine = setupRouter
 	openBrowserFunc func(string)  = openBrowser
+	workers                       = flag.Int("workers", 5, "number of concurrent downloads")
+	perHost                       = flag.Int("per-host", 0, "max concurrent downloads from a single host, 0 means no limit")
+	retries                       = flag.Int("retries", 3, "number of retries of a failed download")
+	retryDelay                    = flag.Duration("retry-delay", time.Second, "delay before the first retry, it is doubled after every attempt")
+	layout                        = flag.String("layout", local.DefaultLayout, "layout of saved photos, e.g. {source}/{album}/{yyyy}/{mm}/{filename}")
+	dedup                         = flag.String("dedup", string(local.DedupOff), "what to do with photos of the same content: off, hardlink, symlink or skip")
+	xmp                           = flag.Bool("xmp", false, "write XMP sidecars next to saved files")
+	exifMerge                     = flag.String("exif-merge", "", "whether tags already in files are overwritten, e.g. created=always,gps=never; policies are never, missing and always")
+	addr                          = flag.String("addr", defaultAddr, "address the server listens on, 0.0.0.0:8080 makes it reachable from other machines")
+	origins                       = flag.String("origins", "", "comma separated origins allowed to call the API besides the address of the server, e.g. http://192.168.1.5:8080")
+	password                      = flag.String("password", "", "password of the app, "+passwordEnv+" is used if it is empty")
+	roots                         = flag.String("roots", "~", "dirs photos are allowed to be saved within, separated by "+string(filepath.ListSeparator)+", empty allows any dir, commands ignore the default")
+	startupToken                  = flag.Bool("startup-token", false, "protect the app with a one-time link printed to the console")
 )
 
 // @title        PhotoDumper
@@ -39,16 +60,61 @@ var (
 // @host      localhost:8080
 // @BasePath  /api/
 // @securitydefinitions.apikey ApiKeyAuth
-// @in query
-// @name api_key
+// @in header
+// @name Authorization
 func main() {
+	flag.Usage = usage
+	flag.Parse()
+	photoLayout, err := local.NewLayout(*layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dedupMode, err := local.ParseDedupMode(*dedup)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mergePolicies, err := local.ParseMergePolicies(*exifMerge)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rootList := *roots
+	if flag.NArg() > 0 {
+		rootList = commandRoots(flag.CommandLine)
+	}
+	allowedRoots, err := local.ParseRoots(rootList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sources.SetWorkers(*workers, *perHost)
 	sources.AddSource(vk.NewService())
 	sources.AddSource(instagram.NewService())
-	sources.AddStorage(local.NewService())
+	sources.AddStorage(local.NewService(local.WithRetries(*retries, *retryDelay), local.WithLayout(photoLayout), local.WithDedup(dedupMode), local.WithSidecars(*xmp), local.WithMergePolicies(mergePolicies), local.WithAllowedRoots(allowedRoots)))
+	if flag.NArg() > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := runCommand(ctx, flag.Args(), os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
+	serverOrigins, err = allowedOrigins(*addr, *origins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *password == "" {
+		*password = os.Getenv(passwordEnv)
+	}
+	token, err := app.configure(*password, *startupToken)
+	if err != nil {
+		log.Fatal(err)
+	}
+	url := browserURL(*addr)
+	if token != "" {
+		url += "/login/?" + loginTokenParam + "=" + token
+		fmt.Println("open", url)
+	}
 	router := setupRouterFunc()
 	if router != nil {
-		go openBrowserFunc("http://localhost:8080")
-		router.Run(":8080")
+		go openBrowserFunc(url)
+		router.Run(*addr)
 	}
 }
 
@@ -1,19 +1,110 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// tokenKey is a key of the context value which keeps the token of the source
+const tokenKey = "token"
+
+// deprecatedTokenParam is a query parameter with the token, it is logged by proxies and kept in browser history
+const deprecatedTokenParam = "api_key"
+
+var warnDeprecatedOnce sync.Once
+
+// Auth finds the token of the source, it is looked up in the Authorization: Bearer header,
+// the session and the deprecated api_key parameter in that order
 func Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		api_key := c.Query("api_key")
-		if api_key == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "please provide api_key"})
+		token := bearerToken(c)
+		if token == "" {
+			token = sessionToken(c, c.Param("sourceName"))
+		}
+		if token == "" {
+			if token = c.Query(deprecatedTokenParam); token != "" {
+				c.Header("Deprecation", "true")
+				warnDeprecatedOnce.Do(func() {
+					log.Println("api_key parameter is deprecated, use the Authorization: Bearer header or a session")
+				})
+			}
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "please provide a token in the Authorization: Bearer header or create a session, api_key is deprecated"})
 			c.Abort()
 			return
 		}
+		c.Set(tokenKey, token)
 		c.Next()
 	}
 }
+
+// bearerToken returns a token of the Authorization: Bearer header
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// sourceToken returns the token found by Auth
+func sourceToken(c *gin.Context) string {
+	return c.GetString(tokenKey)
+}
+
+// redactedParams are query parameters which values are not logged
+var redactedParams = []string{deprecatedTokenParam, loginTokenParam}
+
+// redactQuery hides tokens of the deprecated parameter and of the login link in a logged path
+func redactQuery(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// the query is not logged if it can't be parsed, so the token doesn't leak
+		return base + "?REDACTED"
+	}
+	redacted := false
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+	return base + "?" + query.Encode()
+}
+
+// logFormatter is the default format of gin with tokens redacted
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,5 +22,74 @@ func TestAuth(t *testing.T) {
 
 	// assert
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
-	assert.Contains(t, w.Body.String(), "please provide api_key")
+	assert.Contains(t, w.Body.String(), "please provide a token")
+}
+
+func TestAuth_token(t *testing.T) {
+	sources.AddSource(&service{})
+	router := gin.New()
+	router.POST("/api/session/:sourceName/", createSessionHandler)
+	router.GET("/api/albums/:sourceName/", Auth(), func(c *gin.Context) {
+		c.String(http.StatusOK, sourceToken(c))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/session/test/", nil)
+	req.Header.Set("Authorization", "Bearer session-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string
+		cookie         bool
+		wantCode       int
+		wantToken      string
+		wantDeprecated bool
+	}{
+		{name: "bearer", path: "/api/albums/test/", header: "Bearer header-token", wantCode: http.StatusOK, wantToken: "header-token"},
+		{name: "bearer goes first", path: "/api/albums/test/?api_key=query-token", header: "bearer header-token", cookie: true, wantCode: http.StatusOK, wantToken: "header-token"},
+		{name: "session", path: "/api/albums/test/?api_key=query-token", cookie: true, wantCode: http.StatusOK, wantToken: "session-token"},
+		{name: "session of another source", path: "/api/albums/vk/", cookie: true, wantCode: http.StatusUnauthorized},
+		{name: "deprecated parameter", path: "/api/albums/test/?api_key=query-token", wantCode: http.StatusOK, wantToken: "query-token", wantDeprecated: true},
+		{name: "basic auth", path: "/api/albums/test/", header: "Basic dXNlcjpwYXNz", wantCode: http.StatusUnauthorized},
+		{name: "no token", path: "/api/albums/test/", wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie {
+				req.AddCookie(cookies[0])
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, tt.wantToken, w.Body.String())
+			}
+			assert.Equal(t, tt.wantDeprecated, w.Header().Get("Deprecation") == "true")
+		})
+	}
+}
+
+func Test_redactQuery(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/albums/vk/", want: "/api/albums/vk/"},
+		{path: "/api/albums/vk/?dir=photos", want: "/api/albums/vk/?dir=photos"},
+		{path: "/api/albums/vk/?api_key=secret&dir=photos", want: "/api/albums/vk/?api_key=REDACTED&dir=photos"},
+		{path: "/api/albums/vk/?api_key=secret;dir", want: "/api/albums/vk/?REDACTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, redactQuery(tt.path))
+		})
+	}
 }
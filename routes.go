@@ -13,27 +13,45 @@ import (
 
 func setupRouter() engine {
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"*"}
+	config.AllowOrigins = serverOrigins
+	config.AllowCredentials = true
+	config.AddAllowHeaders("Authorization", appTokenHeader)
 	assets, err := fs.Sub(staticAssets, "build")
 	if err != nil {
 		fmt.Println("build folder is not readable")
 		return nil
 	}
 	assetsFS := http.FS(assets)
-	router := gin.Default()
-	router.Use(cors.New(config))
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(logFormatter), gin.Recovery())
+	router.Use(AllowedHosts(), cors.New(config))
 	router.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusTemporaryRedirect, "/assets/index.html")
 	})
 	router.StaticFS("/assets/", assetsFS)
-	api := router.Group("/api")
+	router.GET("/login/", loginHandler)
+	router.POST("/login/", CSRF(), loginHandler)
+	// csrf protects calls which change state
+	csrf := CSRF()
+	api := router.Group("/api", AppAuth())
 	{
 		api.GET("/sources/", sourcesHandler)
+		api.GET("/jobs/", jobsHandler)
+		api.GET("/jobs/:jobID/", jobHandler)
+		api.POST("/jobs/:jobID/cancel/", csrf, cancelJobHandler)
+		api.POST("/jobs/:jobID/pause/", csrf, pauseJobHandler)
+		api.POST("/jobs/:jobID/resume/", csrf, resumeJobHandler)
+		api.GET("/jobs/:jobID/failed/", failedItemsHandler)
+		api.GET("/jobs/:jobID/metadata/", metadataHandler)
+		api.GET("/jobs/:jobID/events/", eventsHandler)
+		api.POST("/jobs/:jobID/retry/", csrf, retryJobHandler)
+		api.POST("/session/:sourceName/", csrf, createSessionHandler)
+		api.DELETE("/session/", csrf, deleteSessionHandler)
 		auth := api.Group("/", Auth())
 		{
 			auth.GET("/albums/:sourceName/", albumsHandler)
-			auth.GET("/download-all-albums/:sourceName/", downloadAllAlbumsHandler)
-			auth.GET("/download-album/:albumID/:sourceName/", downloadAlbumHandler)
+			auth.GET("/download-all-albums/:sourceName/", csrf, downloadAllAlbumsHandler)
+			auth.GET("/download-album/:albumID/:sourceName/", csrf, downloadAlbumHandler)
 		}
 
 	}
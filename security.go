@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultAddr is loopback, so other machines can't reach the server
+	defaultAddr = "127.0.0.1:8080"
+	// appCookie keeps an ID of a session of the app, it is given by /login/
+	appCookie = "photodumper_app"
+	// appTokenHeader carries the app password for scripts
+	appTokenHeader = "X-App-Token"
+	// loginTokenParam carries the startup token or the password to /login/
+	loginTokenParam = "token"
+	// passwordEnv keeps the app password out of the process list
+	passwordEnv = "PHOTODUMPER_PASSWORD"
+)
+
+// serverOrigins are origins allowed to call the API, main sets them by the address of the server and -origins
+var serverOrigins, _ = allowedOrigins(defaultAddr, "")
+
+// app protects the API by a password or a startup token, it is off unless main configures it
+var app = &appAccess{}
+
+// allowedOrigins returns origins of the server at addr and extra ones, a comma separated list
+func allowedOrigins(addr, extra string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("address %q is invalid: %w", addr, err)
+	}
+	origins := []string{
+		"http://localhost:" + port,
+		"http://127.0.0.1:" + port,
+		"http://[::1]:" + port,
+	}
+	if ip := net.ParseIP(host); host != "" && host != "localhost" && (ip == nil || !ip.IsLoopback() && !ip.IsUnspecified()) {
+		origins = append(origins, "http://"+net.JoinHostPort(host, port))
+	}
+	for _, origin := range strings.Split(extra, ",") {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin == "" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return nil, fmt.Errorf("origin %q is invalid, it looks like http://192.168.1.5:8080", origin)
+		}
+		if !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	return origins, nil
+}
+
+// browserURL returns a URL of the server at addr which is opened in the browser
+func browserURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://localhost:8080"
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// allowedOrigin reports whether origin is one of serverOrigins
+func allowedOrigin(origin string) bool {
+	return slices.Contains(serverOrigins, strings.ToLower(origin))
+}
+
+// AllowedHosts rejects requests to hosts which are not of serverOrigins, a web page can't reach the server
+// by a domain resolved to a local address (DNS rebinding)
+func AllowedHosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := strings.ToLower(c.Request.Host)
+		if host == "" {
+			c.Next()
+			return
+		}
+		for _, origin := range serverOrigins {
+			if u, err := url.Parse(origin); err == nil && u.Host == host {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "host is not allowed, add it to -origins"})
+		c.Abort()
+	}
+}
+
+// CSRF rejects state-changing requests sent by pages of other origins, requests without Origin are checked
+// by Sec-Fetch-Site. Scripts don't send either of them, so they are not affected.
+func CSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		sameOrigin := origin == "http://"+c.Request.Host || origin == "https://"+c.Request.Host
+		switch {
+		case origin != "" && !sameOrigin && !allowedOrigin(origin):
+		case origin == "" && (c.GetHeader("Sec-Fetch-Site") == "cross-site" || c.GetHeader("Sec-Fetch-Site") == "same-site"):
+		default:
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "request of another site is rejected"})
+		c.Abort()
+	}
+}
+
+// appAccess keeps the app password, the startup token and sessions they are exchanged for
+type appAccess struct {
+	mu       sync.Mutex
+	password string
+	// startupToken is exchanged for a session once, it is empty after that
+	startupToken string
+	sessions     map[string]bool
+}
+
+// configure turns the protection on if password is set or startupToken is true, it returns the startup token
+func (a *appAccess) configure(password string, startupToken bool) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.password = password
+	a.startupToken = ""
+	a.sessions = map[string]bool{}
+	if startupToken {
+		token, err := newSessionID()
+		if err != nil {
+			return "", err
+		}
+		a.startupToken = token
+	}
+	return a.startupToken, nil
+}
+
+// enabled must be called with a.mu held
+func (a *appAccess) enabled() bool {
+	return a.password != "" || a.startupToken != "" || len(a.sessions) > 0
+}
+
+// authorized reports whether the request has a session of the app or the password
+func (a *appAccess) authorized(c *gin.Context) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.enabled() {
+		return true
+	}
+	if id, err := c.Cookie(appCookie); err == nil && a.sessions[id] {
+		return true
+	}
+	return a.password != "" && equal(c.GetHeader(appTokenHeader), a.password)
+}
+
+// login exchanges the password or the startup token for a session, it returns an ID of the session
+func (a *appAccess) login(secret string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case secret == "":
+		return "", false
+	case a.password != "" && equal(secret, a.password):
+	case a.startupToken != "" && equal(secret, a.startupToken):
+		a.startupToken = ""
+	default:
+		return "", false
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return "", false
+	}
+	a.sessions[id] = true
+	return id, true
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// AppAuth rejects requests without a session of the app or the password if the app is protected
+func AppAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if app.authorized(c) {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "the app is protected, open the link printed to the console or log in at /login/"})
+		c.Abort()
+	}
+}
+
+const loginPage = `<!DOCTYPE html>
+<html>
+<head><title>PhotoDumper</title></head>
+<body>
+<form method="post" action="/login/">
+<input type="password" name="password" placeholder="password" autofocus>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`
+
+// loginHandler exchanges ?token= of the startup link or the password of the form for a session cookie
+func loginHandler(c *gin.Context) {
+	secret := c.Query(loginTokenParam)
+	if c.Request.Method == http.MethodPost {
+		secret = c.PostForm("password")
+	}
+	if secret == "" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(loginPage))
+		return
+	}
+	id, ok := app.login(secret)
+	if !ok {
+		c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(loginPage))
+		return
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(appCookie, id, 0, "/", "", false, true)
+	c.Redirect(http.StatusSeeOther, "/")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_allowedOrigins(t *testing.T) {
+	loopback := []string{"http://localhost:8080", "http://127.0.0.1:8080", "http://[::1]:8080"}
+	tests := []struct {
+		name    string
+		addr    string
+		extra   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "loopback", addr: "127.0.0.1:8080", want: loopback},
+		{name: "all interfaces", addr: "0.0.0.0:8080", want: loopback},
+		{name: "port only", addr: ":8080", want: loopback},
+		{name: "lan address", addr: "192.168.1.5:8080", want: append(loopback, "http://192.168.1.5:8080")},
+		{name: "extra", addr: "127.0.0.1:8080", extra: " https://Photos.example.com/, http://localhost:8080", want: append(loopback, "https://photos.example.com")},
+		{name: "invalid addr", addr: "8080", wantErr: true},
+		{name: "origin with path", addr: "127.0.0.1:8080", extra: "http://example.com/app", wantErr: true},
+		{name: "origin without scheme", addr: "127.0.0.1:8080", extra: "example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allowedOrigins(tt.addr, tt.extra)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_browserURL(t *testing.T) {
+	assert.Equal(t, "http://127.0.0.1:8080", browserURL("127.0.0.1:8080"))
+	assert.Equal(t, "http://localhost:9090", browserURL("0.0.0.0:9090"))
+	assert.Equal(t, "http://localhost:8080", browserURL(":8080"))
+	assert.Equal(t, "http://[::1]:8080", browserURL("[::1]:8080"))
+}
+
+func Test_protection(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		host     string
+		header   map[string]string
+		wantCode int
+	}{
+		{name: "script", method: http.MethodPost, path: "/api/jobs/nonExistent/cancel/", wantCode: http.StatusNotFound},
+		{name: "same origin", method: http.MethodPost, path: "/api/jobs/nonExistent/cancel/", host: "localhost:8080", header: map[string]string{"Origin": "http://localhost:8080"}, wantCode: http.StatusNotFound},
+		{name: "allowed origin", method: http.MethodPost, path: "/api/jobs/nonExistent/cancel/", host: "localhost:8080", header: map[string]string{"Origin": "http://127.0.0.1:8080"}, wantCode: http.StatusNotFound},
+		{name: "other origin", method: http.MethodPost, path: "/api/jobs/nonExistent/cancel/", host: "localhost:8080", header: map[string]string{"Origin": "http://evil.example.com"}, wantCode: http.StatusForbidden},
+		{name: "cross-site download", method: http.MethodGet, path: "/api/download-album/albumid/test/?api_key=sdfsdf", host: "localhost:8080", header: map[string]string{"Sec-Fetch-Site": "cross-site"}, wantCode: http.StatusForbidden},
+		{name: "same-site download", method: http.MethodGet, path: "/api/download-album/albumid/test/?api_key=sdfsdf", host: "localhost:8080", header: map[string]string{"Sec-Fetch-Site": "same-site"}, wantCode: http.StatusForbidden},
+		{name: "cross-site read", method: http.MethodGet, path: "/api/jobs/nonExistent/", host: "localhost:8080", header: map[string]string{"Sec-Fetch-Site": "cross-site"}, wantCode: http.StatusNotFound},
+		{name: "rebound host", method: http.MethodGet, path: "/api/jobs/", host: "evil.example.com:8080", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Host = tt.host
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func Test_appAccess(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+	token, err := app.configure("secret", true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	t.Cleanup(func() { app.configure("", false) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/jobs/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// scripts send the password
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/jobs/", nil)
+	req2.Header.Set(appTokenHeader, "secret")
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+
+	// the startup link is exchanged for a session once
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodGet, "/login/?token="+token, nil)
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusSeeOther, w3.Code)
+	cookies := w3.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	w4 := httptest.NewRecorder()
+	req4, _ := http.NewRequest(http.MethodGet, "/login/?token="+token, nil)
+	router.ServeHTTP(w4, req4)
+	assert.Equal(t, http.StatusUnauthorized, w4.Code)
+
+	w5 := httptest.NewRecorder()
+	req5, _ := http.NewRequest(http.MethodGet, "/api/jobs/", nil)
+	req5.AddCookie(cookies[0])
+	router.ServeHTTP(w5, req5)
+	assert.Equal(t, http.StatusOK, w5.Code)
+
+	// the password is given by the form
+	form := url.Values{"password": {"secret"}}
+	w6 := httptest.NewRecorder()
+	req6, _ := http.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+	req6.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w6, req6)
+	assert.Equal(t, http.StatusSeeOther, w6.Code)
+
+	w7 := httptest.NewRecorder()
+	req7, _ := http.NewRequest(http.MethodGet, "/login/", nil)
+	router.ServeHTTP(w7, req7)
+	assert.Equal(t, http.StatusOK, w7.Code)
+	assert.Contains(t, w7.Body.String(), `name="password"`)
+}
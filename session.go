@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sessionCookie keeps an opaque ID of a session, tokens never leave the server once they are exchanged
+	sessionCookie = "photodumper_session"
+	// sessionTTL is a lifetime of a session since the last exchange of a token
+	sessionTTL = 24 * time.Hour
+)
+
+// session keeps tokens of sources by their names
+type session struct {
+	tokens  map[string]string
+	expires time.Time
+}
+
+var (
+	sessions   = map[string]*session{}
+	sessionsMu sync.Mutex
+)
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sessionToken returns a token of the source kept by the session of the request
+func sessionToken(c *gin.Context, sourceName string) string {
+	id, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		return ""
+	}
+	if time.Now().After(s.expires) {
+		delete(sessions, id)
+		return ""
+	}
+	return s.tokens[sourceName]
+}
+
+func setSessionCookie(c *gin.Context, id string, maxAge int) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookie, id, maxAge, "/api/", "", false, true)
+}
+
+// createSessionHandler godoc
+// @Summary      Create session
+// @Description  exchanges a token of the source given by the Authorization header for a session cookie, so the token is not sent again. Tokens of several sources share the session.
+// @Produce      json
+// @Accept       json
+// @Param        sourceName  path      string  true  "source name"
+// @Success      200         {string}  string
+// @Failure      400         {string}  string  "error"
+// @Failure      401         {string}  string  "error"
+// @Failure      500         {string}  string  "error"
+// @Security     ApiKeyAuth
+// @Router       /session/{sourceName}/ [post]
+func createSessionHandler(c *gin.Context) {
+	sourceName := c.Param("sourceName")
+	if !slices.Contains(sources.Sources(), sourceName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is unknown"})
+		return
+	}
+	token := bearerToken(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "please provide a token in the Authorization: Bearer header"})
+		return
+	}
+	sessionsMu.Lock()
+	id, _ := c.Cookie(sessionCookie)
+	s, ok := sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		var err error
+		if id, err = newSessionID(); err != nil {
+			sessionsMu.Unlock()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s = &session{tokens: map[string]string{}}
+		sessions[id] = s
+	}
+	s.tokens[sourceName] = token
+	s.expires = time.Now().Add(sessionTTL)
+	sessionsMu.Unlock()
+	setSessionCookie(c, id, int(sessionTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"source": sourceName, "error": ""})
+}
+
+// deleteSessionHandler godoc
+// @Summary      Delete session
+// @Description  forgets tokens of the session and clears the session cookie
+// @Produce      json
+// @Accept       json
+// @Success      200  {string}  string
+// @Router       /session/ [delete]
+func deleteSessionHandler(c *gin.Context) {
+	if id, err := c.Cookie(sessionCookie); err == nil {
+		sessionsMu.Lock()
+		delete(sessions, id)
+		sessionsMu.Unlock()
+	}
+	setSessionCookie(c, "", -1)
+	c.JSON(http.StatusOK, gin.H{"error": ""})
+}
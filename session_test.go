@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createSession(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		wantCode int
+	}{
+		{name: "ok", path: "/api/session/test/", header: "Bearer sdfsdf", wantCode: http.StatusOK},
+		{name: "unknown source", path: "/api/session/test1/", header: "Bearer sdfsdf", wantCode: http.StatusBadRequest},
+		{name: "no token", path: "/api/session/test/", wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func Test_deleteSession(t *testing.T) {
+	sources.AddSource(&service{})
+	sources.AddStorage(&storage{})
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/session/test/", nil)
+	req.Header.Set("Authorization", "Bearer sdfsdf")
+	router.ServeHTTP(w, req)
+	cookie := w.Result().Cookies()[0]
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest(http.MethodGet, "/api/albums/test/", nil)
+	req2.AddCookie(cookie)
+	router.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest(http.MethodDelete, "/api/session/", nil)
+	req3.AddCookie(cookie)
+	router.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusOK, w3.Code)
+	assert.Equal(t, -1, w3.Result().Cookies()[0].MaxAge)
+
+	w4 := httptest.NewRecorder()
+	req4, _ := http.NewRequest(http.MethodGet, "/api/albums/test/", nil)
+	req4.AddCookie(cookie)
+	router.ServeHTTP(w4, req4)
+	assert.Equal(t, http.StatusUnauthorized, w4.Code)
+}
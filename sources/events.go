@@ -0,0 +1,63 @@
+package sources
+
+import "time"
+
+// types of job events
+const (
+	// EventAlbumStarted is emitted when the first photo of an album is fetched
+	EventAlbumStarted = "album_started"
+	// EventPhotoSaved is emitted when a photo is saved
+	EventPhotoSaved = "photo_saved"
+	// EventPhotoFailed is emitted when a photo is not saved
+	EventPhotoFailed = "photo_failed"
+	// EventAlbumFailed is emitted when photos of an album can't be received
+	EventAlbumFailed = "album_failed"
+	// EventJobFinished is the last event of a job, it is emitted when the job is finished or canceled
+	EventJobFinished = "job_finished"
+)
+
+// Event tells about progress of a job, fields which don't concern the type are empty
+type Event struct {
+	// ID is a sequence number of the event within the job, it starts with 1
+	ID      int       `json:"id"`
+	Type    string    `json:"type"`
+	JobID   string    `json:"job_id"`
+	AlbumID string    `json:"album_id,omitempty"`
+	Album   string    `json:"album,omitempty"`
+	PhotoID string    `json:"photo_id,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	Stage   string    `json:"stage,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Status  JobStatus `json:"status,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// emit must be called with j.mu held, it appends the event to the log of the job and wakes up waiting readers
+func (j *Job) emit(event Event) {
+	event.ID = len(j.events) + 1
+	event.JobID = j.ID
+	event.Time = time.Now()
+	j.events = append(j.events, event)
+	if j.changed != nil {
+		close(j.changed)
+		j.changed = nil
+	}
+}
+
+// EventsAfter returns events of the job which follow the event with the given ID, 0 returns all events.
+// changed is closed when a new event is emitted, a reader waits for it and asks for the next events.
+func (j *Job) EventsAfter(id int) (events []Event, changed <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if id < 0 {
+		id = 0
+	}
+	if id < len(j.events) {
+		events = append(events, j.events[id:]...)
+	}
+	if j.changed == nil {
+		j.changed = make(chan struct{})
+	}
+	return events, j.changed
+}
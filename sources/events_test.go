@@ -0,0 +1,66 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJob_EventsAfter(t *testing.T) {
+	job := newJob(context.Background(), "test", "dir")
+	events, changed := job.EventsAfter(0)
+	assert.Empty(t, events)
+
+	job.queue()
+	job.fail(&PhotoItem{id: "1", albumID: "10", albumName: "a"}, StageDownload, errors.New("failed"))
+	select {
+	case <-changed:
+	default:
+		t.Fatal("changed is not closed")
+	}
+	events, _ = job.EventsAfter(0)
+	assert.Len(t, events, 1)
+	assert.Equal(t, Event{ID: 1, Type: EventPhotoFailed, JobID: job.ID, AlbumID: "10", Album: "a", PhotoID: "1", Stage: StageDownload, Error: "failed", Time: events[0].Time}, events[0])
+
+	job.endFetch()
+	events, _ = job.EventsAfter(1)
+	assert.Len(t, events, 1)
+	assert.Equal(t, 2, events[0].ID)
+	assert.Equal(t, EventJobFinished, events[0].Type)
+	assert.Equal(t, JobFinished, events[0].Status)
+
+	events, changed = job.EventsAfter(2)
+	assert.Empty(t, events)
+	select {
+	case <-changed:
+		t.Fatal("changed is closed without events")
+	default:
+	}
+}
+
+func TestSocial_DownloadAlbumEvents(t *testing.T) {
+	storage := &countingStorage{failures: map[string]int{"https://example.com/2.jpg": 1}}
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumID: "10", albumName: "a"},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumID: "10", albumName: "a"},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "10", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	events, _ := job.EventsAfter(0)
+	types := map[string]int{}
+	for i, event := range events {
+		assert.Equal(t, i+1, event.ID)
+		types[event.Type]++
+	}
+	assert.Equal(t, map[string]int{EventAlbumStarted: 1, EventPhotoSaved: 1, EventPhotoFailed: 1, EventJobFinished: 1}, types)
+	assert.Equal(t, Event{ID: 1, Type: EventAlbumStarted, JobID: job.ID, AlbumID: "10", Album: "a", Time: events[0].Time}, events[0])
+	assert.Equal(t, EventJobFinished, events[len(events)-1].Type)
+}
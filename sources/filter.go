@@ -0,0 +1,72 @@
+package sources
+
+import "time"
+
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+)
+
+// MediaInfo is implemented by photos which know their media type and resolution,
+// photos which don't implement it are treated as images of unknown resolution
+type MediaInfo interface {
+	MediaType() string
+	// Resolution returns zeros if it is unknown
+	Resolution() (width, height int)
+}
+
+// Filter selects photos to download, zero fields match everything
+type Filter struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// MediaType is MediaImage or MediaVideo
+	MediaType string
+	// MinWidth and MinHeight exclude photos of unknown resolution
+	MinWidth  int
+	MinHeight int
+	HasGPS    bool
+}
+
+// needsExif reports whether the filter uses ExifInfo of photos
+func (f *Filter) needsExif() bool {
+	return !f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero() || f.HasGPS
+}
+
+// Match reports whether the photo passes the filter, nil filter matches everything
+func (f *Filter) Match(photo Photo) bool {
+	if f == nil {
+		return true
+	}
+	mediaType := MediaImage
+	var width, height int
+	if info, ok := photo.(MediaInfo); ok {
+		mediaType = info.MediaType()
+		width, height = info.Resolution()
+	}
+	if f.MediaType != "" && f.MediaType != mediaType {
+		return false
+	}
+	if width < f.MinWidth || height < f.MinHeight {
+		return false
+	}
+	if !f.needsExif() {
+		return true
+	}
+	exif, err := photo.ExifInfo()
+	if err != nil || exif == nil {
+		return false
+	}
+	created := exif.Created()
+	if !f.CreatedAfter.IsZero() && created.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !created.Before(f.CreatedBefore) {
+		return false
+	}
+	if f.HasGPS {
+		if !HasLocation(exif.GPS()) {
+			return false
+		}
+	}
+	return true
+}
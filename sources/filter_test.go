@@ -0,0 +1,98 @@
+package sources
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type exifInfo struct {
+	created time.Time
+	gps     []float64
+}
+
+func (e *exifInfo) Description() string {
+	return ""
+}
+
+func (e *exifInfo) Created() time.Time {
+	return e.created
+}
+
+func (e *exifInfo) GPS() []float64 {
+	return e.gps
+}
+
+// detailedExif implements ExifDetails
+type detailedExif struct {
+	exifInfo
+	title    string
+	keywords []string
+}
+
+func (e *detailedExif) Title() string {
+	return e.title
+}
+
+func (e *detailedExif) Keywords() []string {
+	return e.keywords
+}
+
+func (e *detailedExif) Author() string {
+	return "author"
+}
+
+func (e *detailedExif) UniqueID() string {
+	return "id"
+}
+
+type mediaItem struct {
+	PhotoItem
+	mediaType string
+	width     int
+	height    int
+}
+
+func (m *mediaItem) MediaType() string {
+	return m.mediaType
+}
+
+func (m *mediaItem) Resolution() (int, int) {
+	return m.width, m.height
+}
+
+func TestFilter_Match(t *testing.T) {
+	day := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	photo := &PhotoItem{exifInfo: &exifInfo{created: day, gps: []float64{45.1, 45.2}}}
+	video := &mediaItem{PhotoItem: *photo, mediaType: MediaVideo, width: 1920, height: 1080}
+	tests := []struct {
+		name   string
+		filter *Filter
+		photo  Photo
+		want   bool
+	}{
+		{name: "nil filter", filter: nil, photo: photo, want: true},
+		{name: "empty filter", filter: &Filter{}, photo: &PhotoItem{err: errors.New("no exif")}, want: true},
+		{name: "created after", filter: &Filter{CreatedAfter: day}, photo: photo, want: true},
+		{name: "created before", filter: &Filter{CreatedBefore: day}, photo: photo, want: false},
+		{name: "in range", filter: &Filter{CreatedAfter: day.AddDate(0, 0, -1), CreatedBefore: day.AddDate(0, 0, 1)}, photo: photo, want: true},
+		{name: "too old", filter: &Filter{CreatedAfter: day.AddDate(0, 0, 1)}, photo: photo, want: false},
+		{name: "exif error", filter: &Filter{CreatedAfter: day}, photo: &PhotoItem{err: errors.New("no exif")}, want: false},
+		{name: "has gps", filter: &Filter{HasGPS: true}, photo: photo, want: true},
+		{name: "no gps", filter: &Filter{HasGPS: true}, photo: &PhotoItem{exifInfo: &exifInfo{}}, want: false},
+		{name: "zero gps", filter: &Filter{HasGPS: true}, photo: &PhotoItem{exifInfo: &exifInfo{gps: []float64{0, 0}}}, want: false},
+		{name: "image by default", filter: &Filter{MediaType: MediaImage}, photo: photo, want: true},
+		{name: "not a video", filter: &Filter{MediaType: MediaVideo}, photo: photo, want: false},
+		{name: "video", filter: &Filter{MediaType: MediaVideo}, photo: video, want: true},
+		{name: "resolution", filter: &Filter{MinWidth: 1920, MinHeight: 1080}, photo: video, want: true},
+		{name: "low resolution", filter: &Filter{MinWidth: 2000}, photo: video, want: false},
+		{name: "unknown resolution", filter: &Filter{MinHeight: 1}, photo: photo, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.photo))
+		})
+	}
+}
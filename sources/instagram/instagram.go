@@ -8,24 +8,53 @@ import (
 )
 
 type PhotoItem struct {
+	id        string
 	url       string
+	albumID   string
 	albumName string
+	mediaType string
 	created   time.Time
+	caption   string
+	username  string
+}
+
+func (f *PhotoItem) ID() string {
+	return f.id
 }
 
 func (f *PhotoItem) Url() string {
 	return f.url
 }
 
+func (f *PhotoItem) AlbumID() string {
+	return f.albumID
+}
+
 func (f *PhotoItem) AlbumName() string {
 	return f.albumName
 }
 
+func (f *PhotoItem) MediaType() string {
+	if f.mediaType == VIDEO_TYPE {
+		return sources.MediaVideo
+	}
+	return sources.MediaImage
+}
+
+// Resolution is unknown, the graph api doesn't provide it
+func (f *PhotoItem) Resolution() (width, height int) {
+	return 0, 0
+}
+
 // It's setting EXIF data for the downloaded file.
 func (f *PhotoItem) ExifInfo() (sources.ExifInfo, error) {
 	exif := &exifInfo{
 		description: fmt.Sprintf("Dumped by photoDumper. Source is vk. Username: %s", f.albumName),
 		created:     f.created,
+		title:       sources.Title(f.caption),
+		keywords:    sources.Keywords(f.albumName, f.caption),
+		author:      f.username,
+		uniqueID:    f.id,
 	}
 	return exif, nil
 }
@@ -33,6 +62,10 @@ func (f *PhotoItem) ExifInfo() (sources.ExifInfo, error) {
 type exifInfo struct {
 	description string
 	created     time.Time
+	title       string
+	keywords    []string
+	author      string
+	uniqueID    string
 }
 
 func (e *exifInfo) Description() string {
@@ -47,6 +80,22 @@ func (e *exifInfo) GPS() []float64 {
 	return nil
 }
 
+func (e *exifInfo) Title() string {
+	return e.title
+}
+
+func (e *exifInfo) Keywords() []string {
+	return e.keywords
+}
+
+func (e *exifInfo) Author() string {
+	return e.author
+}
+
+func (e *exifInfo) UniqueID() string {
+	return e.uniqueID
+}
+
 type service struct{}
 
 func (s *service) Kind() sources.Kind {
@@ -101,7 +150,8 @@ func (ig *Instagram) AllAlbums() ([]map[string]string, error) {
 }
 
 type fetcher struct {
-	media *PagingResponse
+	media   *PagingResponse
+	albumID string
 }
 
 func (f *fetcher) Next() bool {
@@ -115,18 +165,23 @@ func (f *fetcher) Item() sources.Photo {
 		date = time.Now()
 	}
 	return &PhotoItem{
+		id:        photo.ID,
 		url:       photo.MediaUrl,
+		albumID:   f.albumID,
 		albumName: photo.Username,
+		mediaType: photo.MediaType,
 		created:   date,
+		caption:   photo.Caption,
+		username:  photo.Username,
 		// latitude:  photo.Lat,
 		// longitude: photo.Long,
 	}
 }
 
 func (ig *Instagram) AlbumPhotos(albumID string) (sources.ItemFetcher, error) {
-	media, err := ig.api.MeMedia("id", "media_url", "timestamp", "caption", "username")
+	media, err := ig.api.MeMedia("id", "media_type", "media_url", "timestamp", "caption", "username")
 	if err != nil {
 		return nil, &sources.AccessError{Err: err, Text: "token is invalid?"}
 	}
-	return &fetcher{media: media}, nil
+	return &fetcher{media: media, albumID: albumID}, nil
 }
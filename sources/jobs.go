@@ -0,0 +1,592 @@
+package sources
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobRunning  JobStatus = "running"
+	JobPaused   JobStatus = "paused"
+	JobCanceled JobStatus = "canceled"
+	JobFinished JobStatus = "finished"
+)
+
+var (
+	jobs   = map[string]*Job{}
+	jobsMu sync.RWMutex
+	// finished jobs are forgotten after jobsTTL, no more than maxFinishedJobs of them are kept
+	jobsTTL         = 24 * time.Hour
+	maxFinishedJobs = 100
+)
+
+type JobError struct {
+	text string
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("Job error: %s", e.text)
+}
+
+// Job tracks progress of a single DownloadAlbum or DownloadAllAlbums call.
+type Job struct {
+	ID     string
+	Source string
+	Dir    string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// photos is a download queue of the job, it is closed when all album fetchers are done
+	photos chan payload
+
+	mu     sync.Mutex
+	status JobStatus
+	// resume is closed when a paused job is resumed, it is nil if the job is not paused
+	resume     chan struct{}
+	queued     int
+	downloaded int
+	failed     int
+	skipped    int
+	// canceled is a number of queued photos which are not saved because the job is canceled
+	canceled   int
+	filtered   int
+	duplicates int
+	// albums counts saved photos by album names
+	albums    map[string]*AlbumStats
+	bytes     int64
+	lastError string
+	started   time.Time
+	finished  time.Time
+	// fetchers is a number of album fetchers which are still pushing photos
+	fetchers int
+	// pending is a number of queued photos which are not processed yet
+	pending  int
+	failures []FailedItem
+	// metadata tells how metadata of every saved photo is kept
+	metadata []MetadataResult
+	// events is a log of progress events, changed is closed when an event is appended
+	events  []Event
+	changed chan struct{}
+	// social is used to persist failed items and to retry them
+	social *Social
+}
+
+const (
+	// StageAlbumPhotos means photos of an album can't be received from the source
+	StageAlbumPhotos = "album_photos"
+	StageAlbumDir    = "create_album_dir"
+	StageDownload    = "download"
+	StageExifInfo    = "exif_info"
+	StageSetExif     = "set_exif"
+	StageDedup       = "dedup"
+	StageSidecar     = "sidecar"
+	StageSetTimes    = "set_times"
+)
+
+// AlbumStats counts photos of an album saved by a job
+type AlbumStats struct {
+	Downloaded int `json:"downloaded"`
+	// Duplicates is a number of downloaded photos which have the same content as already saved ones
+	Duplicates int `json:"duplicates"`
+}
+
+// FailedItem describes a photo which failed at a stage of saving, an item of a whole album
+// which photos can't be received has no photo ID and URL
+type FailedItem struct {
+	PhotoID string `json:"photo_id"`
+	URL     string `json:"url"`
+	AlbumID string `json:"album_id"`
+	Album   string `json:"album"`
+	Stage   string `json:"stage"`
+	Error   string `json:"error"`
+	// Fatal means the photo is not saved, otherwise it is saved without a later stage, e.g. its exif.
+	// Only fatal items are retried.
+	Fatal bool      `json:"fatal"`
+	Time  time.Time `json:"time"`
+	photo Photo
+}
+
+// outcomes of saving metadata of a photo
+const (
+	// MetadataEmbedded means metadata is written into the file
+	MetadataEmbedded = "embedded"
+	// MetadataSidecar means metadata can't be embedded into the file, it is written to a sidecar instead
+	MetadataSidecar = "sidecar"
+	// MetadataShared means the file is a duplicate, it has metadata of the original photo
+	MetadataShared = "shared"
+	// MetadataNone means the source has no metadata of the photo
+	MetadataNone = "none"
+	// MetadataFailed means metadata is neither embedded nor written to a sidecar
+	MetadataFailed = "failed"
+)
+
+// MetadataResult tells how metadata of a saved photo is kept
+type MetadataResult struct {
+	PhotoID string `json:"photo_id"`
+	Album   string `json:"album"`
+	Path    string `json:"path"`
+	Outcome string `json:"outcome"`
+	// Error tells why metadata is not embedded into the file
+	Error string `json:"error,omitempty"`
+}
+
+// JobInfo is a snapshot of a job state
+type JobInfo struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"`
+	Dir        string    `json:"dir"`
+	Status     JobStatus `json:"status"`
+	Queued     int       `json:"queued"`
+	Downloaded int       `json:"downloaded"`
+	// Failed is a number of photos which are not saved and albums which photos can't be received
+	Failed int `json:"failed"`
+	// Skipped is a number of photos which are already saved or have no url
+	Skipped int `json:"skipped"`
+	// Canceled is a number of queued photos which are not saved because the job is canceled
+	Canceled int `json:"canceled"`
+	// Filtered is a number of photos which don't match the filter
+	Filtered int `json:"filtered"`
+	// Duplicates is a number of downloaded photos which have the same content as already saved ones
+	Duplicates int                   `json:"duplicates"`
+	Albums     map[string]AlbumStats `json:"albums"`
+	Bytes      int64                 `json:"bytes"`
+	LastError  string                `json:"last_error,omitempty"`
+	// FailedItems is a number of failed items, see Job.Failures. It counts both photos which are not saved
+	// and saved photos with a failed stage, e.g. set_exif, so it may be greater than Failed.
+	FailedItems int `json:"failed_items"`
+	// Metadata counts saved photos by outcomes of saving their metadata, see Job.Metadata
+	Metadata map[string]int `json:"metadata"`
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// newJob registers a job. The job is running until endFetch is called for the creator and all album fetchers
+func newJob(ctx context.Context, source, dir string) *Job {
+	ctx, cancel := context.WithCancel(ctx)
+	job := &Job{
+		ID:       newJobID(),
+		Source:   source,
+		Dir:      dir,
+		ctx:      ctx,
+		cancel:   cancel,
+		photos:   make(chan payload, maxConcurrentFiles),
+		status:   JobRunning,
+		started:  time.Now(),
+		fetchers: 1,
+	}
+	jobsMu.Lock()
+	pruneJobs(job.started)
+	jobs[job.ID] = job
+	jobsMu.Unlock()
+	return job
+}
+
+// pruneJobs must be called with jobsMu held, it forgets finished jobs which are older than jobsTTL
+// and the oldest ones beyond maxFinishedJobs
+func pruneJobs(now time.Time) {
+	finished := []*Job{}
+	for id, job := range jobs {
+		job.mu.Lock()
+		done := job.status == JobFinished || job.status == JobCanceled
+		expired := done && now.Sub(job.finished) > jobsTTL
+		job.mu.Unlock()
+		switch {
+		case expired:
+			delete(jobs, id)
+		case done:
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	// finished times of the jobs are not changed anymore
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].finished.Before(finished[k].finished)
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(jobs, job.ID)
+	}
+}
+
+// Info returns a snapshot of the job
+func (j *Job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := JobInfo{
+		ID:          j.ID,
+		Source:      j.Source,
+		Dir:         j.Dir,
+		Status:      j.status,
+		Queued:      j.queued,
+		Downloaded:  j.downloaded,
+		Failed:      j.failed,
+		Skipped:     j.skipped,
+		Canceled:    j.canceled,
+		Filtered:    j.filtered,
+		Duplicates:  j.duplicates,
+		Albums:      make(map[string]AlbumStats, len(j.albums)),
+		Bytes:       j.bytes,
+		LastError:   j.lastError,
+		FailedItems: len(j.failures),
+		Metadata:    map[string]int{},
+		Started:     j.started,
+	}
+	for name, stats := range j.albums {
+		info.Albums[name] = *stats
+	}
+	for _, result := range j.metadata {
+		info.Metadata[result.Outcome]++
+	}
+	if j.status == JobRunning && j.resume != nil {
+		info.Status = JobPaused
+	}
+	if j.status == JobRunning && j.ctx.Err() != nil {
+		info.Status = JobCanceled
+	}
+	if j.status == JobFinished || j.status == JobCanceled {
+		finished := j.finished
+		info.Finished = &finished
+	}
+	return info
+}
+
+// Cancel stops the job, queued photos are not downloaded
+func (j *Job) Cancel() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobRunning {
+		return &JobError{text: fmt.Sprintf("job is %s", j.status)}
+	}
+	j.cancel()
+	return nil
+}
+
+// Pause suspends the job until Resume or Cancel is called
+func (j *Job) Pause() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobRunning {
+		return &JobError{text: fmt.Sprintf("job is %s", j.status)}
+	}
+	if j.resume == nil {
+		j.resume = make(chan struct{})
+	}
+	return nil
+}
+
+// Resume continues the paused job
+func (j *Job) Resume() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobRunning {
+		return &JobError{text: fmt.Sprintf("job is %s", j.status)}
+	}
+	if j.resume != nil {
+		close(j.resume)
+		j.resume = nil
+	}
+	return nil
+}
+
+// wait blocks while the job is paused, it returns an error if the job is canceled
+func (j *Job) wait() error {
+	for {
+		j.mu.Lock()
+		resume := j.resume
+		j.mu.Unlock()
+		if resume == nil {
+			return j.ctx.Err()
+		}
+		select {
+		case <-resume:
+		case <-j.ctx.Done():
+			return j.ctx.Err()
+		}
+	}
+}
+
+func (j *Job) beginFetch() {
+	j.mu.Lock()
+	j.fetchers++
+	j.mu.Unlock()
+}
+
+func (j *Job) endFetch() {
+	j.update(func() {
+		j.fetchers--
+		if j.fetchers == 0 {
+			close(j.photos)
+		}
+	})
+}
+
+func (j *Job) queue() {
+	j.mu.Lock()
+	j.queued++
+	j.pending++
+	j.mu.Unlock()
+}
+
+func (j *Job) skip() {
+	j.mu.Lock()
+	j.skipped++
+	j.mu.Unlock()
+}
+
+// exclude skips a photo which doesn't match the filter
+func (j *Job) exclude() {
+	j.mu.Lock()
+	j.filtered++
+	j.mu.Unlock()
+}
+
+// drop gives up a queued photo of the canceled job
+func (j *Job) drop() {
+	j.update(func() {
+		j.canceled++
+		j.pending--
+	})
+}
+
+// albumStarted emits EventAlbumStarted for the first fetched photo of an album
+func (j *Job) albumStarted(photo Photo) {
+	j.mu.Lock()
+	j.emit(Event{Type: EventAlbumStarted, AlbumID: photo.AlbumID(), Album: photo.AlbumName()})
+	j.mu.Unlock()
+}
+
+// done records a saved photo, the file tells whether its content is the same as of an already saved photo
+func (j *Job) done(photo Photo, saved *File) {
+	duplicate := saved.DuplicateOf != ""
+	j.update(func() {
+		j.downloaded++
+		j.bytes += saved.Size
+		j.pending--
+		j.emit(Event{Type: EventPhotoSaved, AlbumID: photo.AlbumID(), Album: photo.AlbumName(), PhotoID: photo.ID(), Path: saved.Path, Size: saved.Size})
+		if j.albums == nil {
+			j.albums = map[string]*AlbumStats{}
+		}
+		stats, ok := j.albums[photo.AlbumName()]
+		if !ok {
+			stats = &AlbumStats{}
+			j.albums[photo.AlbumName()] = stats
+		}
+		stats.Downloaded++
+		if duplicate {
+			j.duplicates++
+			stats.Duplicates++
+		}
+	})
+}
+
+// fail records a queued photo which is not saved
+func (j *Job) fail(photo Photo, stage string, err error) {
+	j.update(func() {
+		j.failed++
+		j.pending--
+		j.addFailure(photo, stage, err, true)
+		j.emit(Event{Type: EventPhotoFailed, AlbumID: photo.AlbumID(), Album: photo.AlbumName(), PhotoID: photo.ID(), Stage: stage, Error: err.Error()})
+	})
+}
+
+// warn records a failed stage of a photo which is saved anyway
+func (j *Job) warn(photo Photo, stage string, err error) {
+	j.mu.Lock()
+	j.addFailure(photo, stage, err, false)
+	j.mu.Unlock()
+}
+
+// failAlbum records an album which photos can't be received
+func (j *Job) failAlbum(albumID, album string, err error) {
+	j.mu.Lock()
+	j.failed++
+	j.lastError = err.Error()
+	j.failures = append(j.failures, FailedItem{
+		AlbumID: albumID,
+		Album:   album,
+		Stage:   StageAlbumPhotos,
+		Error:   err.Error(),
+		Fatal:   true,
+		Time:    time.Now(),
+	})
+	j.emit(Event{Type: EventAlbumFailed, AlbumID: albumID, Album: album, Stage: StageAlbumPhotos, Error: err.Error()})
+	j.mu.Unlock()
+}
+
+// metadataSaved records an outcome of saving metadata of a saved photo, err tells why it is not embedded
+func (j *Job) metadataSaved(photo Photo, path, outcome string, err error) {
+	result := MetadataResult{PhotoID: photo.ID(), Album: photo.AlbumName(), Path: path, Outcome: outcome}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	j.mu.Lock()
+	j.metadata = append(j.metadata, result)
+	j.mu.Unlock()
+}
+
+// addFailure must be called with j.mu held
+func (j *Job) addFailure(photo Photo, stage string, err error, fatal bool) {
+	j.lastError = err.Error()
+	j.failures = append(j.failures, FailedItem{
+		PhotoID: photo.ID(),
+		URL:     photo.Url(),
+		AlbumID: photo.AlbumID(),
+		Album:   photo.AlbumName(),
+		Stage:   stage,
+		Error:   err.Error(),
+		Fatal:   fatal,
+		Time:    time.Now(),
+		photo:   photo,
+	})
+}
+
+// update changes the job under the lock, then finishes the job if nothing is left to do
+func (j *Job) update(change func()) {
+	j.mu.Lock()
+	change()
+	finished := j.checkFinished()
+	j.mu.Unlock()
+	if finished {
+		j.finish()
+	}
+}
+
+// checkFinished must be called with j.mu held, it returns true if the job has just finished
+func (j *Job) checkFinished() bool {
+	if j.status == JobRunning && j.fetchers == 0 && j.pending == 0 {
+		j.status = JobFinished
+		if j.ctx.Err() != nil {
+			j.status = JobCanceled
+		}
+		j.finished = time.Now()
+		j.cancel()
+		j.emit(Event{Type: EventJobFinished, Status: j.status})
+		return true
+	}
+	return false
+}
+
+// finish persists the failed items next to the downloaded photos
+func (j *Job) finish() {
+	j.mu.Lock()
+	social := j.social
+	failures := append([]FailedItem(nil), j.failures...)
+	j.mu.Unlock()
+	if social == nil || len(failures) == 0 {
+		return
+	}
+	data, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := social.storage.SaveReport(j.Dir, fmt.Sprintf("failed-%s.json", j.ID), data); err != nil {
+		log.Println("failed items were not saved", err)
+	}
+}
+
+// Failures returns the failed items of the job
+func (j *Job) Failures() []FailedItem {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]FailedItem{}, j.failures...)
+}
+
+// Metadata returns outcomes of saving metadata of the saved photos
+func (j *Job) Metadata() []MetadataResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]MetadataResult{}, j.metadata...)
+}
+
+// Retry starts a new job which downloads the fatal failed items of the finished job again,
+// saved photos with a failed stage are not downloaded again. Failed albums are fetched again,
+// their photos which are already saved are skipped.
+func (j *Job) Retry() (*Job, error) {
+	j.mu.Lock()
+	status := j.status
+	social := j.social
+	failures := []FailedItem{}
+	for _, item := range j.failures {
+		if item.Fatal {
+			failures = append(failures, item)
+		}
+	}
+	j.mu.Unlock()
+	if status == JobRunning {
+		return nil, &JobError{text: "job is running"}
+	}
+	if len(failures) == 0 || social == nil {
+		return nil, &JobError{text: "nothing to retry"}
+	}
+	retry := social.startJob(context.WithoutCancel(j.ctx), j.Dir)
+	go func() {
+		defer retry.endFetch()
+		seen := map[string]bool{}
+		for _, item := range failures {
+			key := item.PhotoID + item.URL
+			if item.photo == nil {
+				key = "album " + item.AlbumID
+			}
+			if seen[key] || retry.wait() != nil {
+				continue
+			}
+			seen[key] = true
+			if item.photo == nil {
+				retry.beginFetch()
+				go func(item FailedItem) {
+					defer retry.endFetch()
+					social.fetchAlbum(retry, item.AlbumID, item.Album)
+				}(item)
+				continue
+			}
+			retry.queue()
+			select {
+			case retry.photos <- payload{photo: item.photo, job: retry}:
+			case <-retry.ctx.Done():
+				retry.drop()
+			}
+		}
+	}()
+	return retry, nil
+}
+
+// GetJob returns a job by its ID
+func GetJob(id string) (*Job, bool) {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	job, ok := jobs[id]
+	return job, ok
+}
+
+// Jobs returns snapshots of all jobs, the oldest one goes first
+func Jobs() []JobInfo {
+	jobsMu.RLock()
+	list := make([]JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job.Info())
+	}
+	jobsMu.RUnlock()
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].Started.Before(list[k].Started)
+	})
+	return list
+}
@@ -0,0 +1,208 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJob_Info(t *testing.T) {
+	tests := []struct {
+		name       string
+		albums     int
+		downloaded []int64
+		failed     int
+		skipped    int
+		want       JobInfo
+	}{
+		{
+			name:       "finished",
+			albums:     2,
+			downloaded: []int64{10, 20},
+			failed:     1,
+			skipped:    3,
+			want: JobInfo{Source: "test", Dir: "dir", Status: JobFinished, Queued: 3, Downloaded: 2, Failed: 1, Skipped: 3, Bytes: 30, LastError: "failed", FailedItems: 1,
+				Albums: map[string]AlbumStats{"album": {Downloaded: 2}}, Metadata: map[string]int{}},
+		},
+		{
+			name:   "no albums",
+			albums: 0,
+			want:   JobInfo{Source: "test", Dir: "dir", Status: JobFinished, Albums: map[string]AlbumStats{}, Metadata: map[string]int{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newJob(context.Background(), "test", "dir")
+			for i := 0; i < tt.albums; i++ {
+				job.beginFetch()
+			}
+			job.endFetch()
+			for range tt.downloaded {
+				job.queue()
+			}
+			for i := 0; i < tt.failed; i++ {
+				job.queue()
+			}
+			for i := 0; i < tt.skipped; i++ {
+				job.skip()
+			}
+			for i := 0; i < tt.albums; i++ {
+				job.endFetch()
+			}
+			if tt.albums > 0 {
+				assert.Equal(t, JobRunning, job.Info().Status)
+			}
+			for _, size := range tt.downloaded {
+				job.done(&PhotoItem{albumName: "album"}, &File{Size: size})
+			}
+			for i := 0; i < tt.failed; i++ {
+				job.fail(&PhotoItem{id: "1"}, StageDownload, errors.New("failed"))
+			}
+			got := job.Info()
+			assert.NotNil(t, got.Finished)
+			assert.Equal(t, job.ID, got.ID)
+			tt.want.ID = got.ID
+			tt.want.Started = got.Started
+			tt.want.Finished = got.Finished
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJob_Cancel(t *testing.T) {
+	job := newJob(context.Background(), "test", "dir")
+	job.queue()
+	assert.NoError(t, job.Cancel())
+	assert.Error(t, job.wait())
+	assert.Equal(t, JobCanceled, job.Info().Status)
+	assert.Nil(t, job.Info().Finished)
+	job.endFetch()
+	job.drop()
+	got := job.Info()
+	assert.Equal(t, JobCanceled, got.Status)
+	assert.NotNil(t, got.Finished)
+	assert.Equal(t, 1, got.Canceled)
+	assert.Equal(t, 0, got.Skipped)
+
+	var e *JobError
+	assert.ErrorAs(t, job.Cancel(), &e)
+	assert.ErrorAs(t, job.Pause(), &e)
+	assert.ErrorAs(t, job.Resume(), &e)
+}
+
+func TestJob_PauseResume(t *testing.T) {
+	job := newJob(context.Background(), "test", "dir")
+	assert.NoError(t, job.Pause())
+	assert.Equal(t, JobPaused, job.Info().Status)
+	waited := make(chan error)
+	go func() {
+		waited <- job.wait()
+	}()
+	select {
+	case <-waited:
+		t.Fatal("wait returned while the job is paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, job.Resume())
+	assert.NoError(t, <-waited)
+	assert.Equal(t, JobRunning, job.Info().Status)
+
+	assert.NoError(t, job.Pause())
+	go func() {
+		waited <- job.wait()
+	}()
+	assert.NoError(t, job.Cancel())
+	assert.Error(t, <-waited)
+	job.endFetch()
+	assert.Equal(t, JobCanceled, job.Info().Status)
+}
+
+func TestJob_RetryError(t *testing.T) {
+	var e *JobError
+	job := newJob(context.Background(), "test", "dir")
+	_, err := job.Retry()
+	assert.ErrorAs(t, err, &e, "job is running")
+
+	job.endFetch()
+	_, err = job.Retry()
+	assert.ErrorAs(t, err, &e, "nothing to retry")
+}
+
+func TestGetJob(t *testing.T) {
+	job := newJob(context.Background(), "test", "dir")
+	tests := []struct {
+		name   string
+		id     string
+		wantOk bool
+	}{
+		{
+			name:   "exists",
+			id:     job.ID,
+			wantOk: true,
+		},
+		{
+			name:   "not found",
+			id:     "nonExistent",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetJob(tt.id)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, job, got)
+			}
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	first := newJob(context.Background(), "test", "dir1")
+	second := newJob(context.Background(), "test", "dir2")
+	got := Jobs()
+	var ids []string
+	for _, info := range got {
+		ids = append(ids, info.ID)
+	}
+	assert.Contains(t, ids, first.ID)
+	assert.Contains(t, ids, second.ID)
+	for i := 1; i < len(got); i++ {
+		assert.False(t, got[i].Started.Before(got[i-1].Started))
+	}
+}
+
+func Test_pruneJobs(t *testing.T) {
+	defer func(ttl time.Duration, max int) {
+		jobsTTL, maxFinishedJobs = ttl, max
+	}(jobsTTL, maxFinishedJobs)
+	jobsTTL = time.Hour
+	maxFinishedJobs = 1
+
+	finish := func(job *Job, at time.Time) {
+		job.endFetch()
+		job.mu.Lock()
+		job.finished = at
+		job.mu.Unlock()
+	}
+	expired := newJob(context.Background(), "test", "dir")
+	finish(expired, time.Now().Add(-2*time.Hour))
+	older := newJob(context.Background(), "test", "dir")
+	finish(older, time.Now().Add(-time.Minute))
+	newer := newJob(context.Background(), "test", "dir")
+	finish(newer, time.Now())
+	running := newJob(context.Background(), "test", "dir")
+	defer running.endFetch()
+
+	for _, job := range []*Job{expired, older} {
+		_, ok := GetJob(job.ID)
+		assert.False(t, ok)
+	}
+	for _, job := range []*Job{newer, running} {
+		_, ok := GetJob(job.ID)
+		assert.True(t, ok)
+	}
+}
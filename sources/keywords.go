@@ -0,0 +1,32 @@
+package sources
+
+import (
+	"regexp"
+	"strings"
+)
+
+var hashtag = regexp.MustCompile(`#[\p{L}\p{N}_]+`)
+
+// Keywords returns the album name and hashtags of the caption without "#", duplicates are dropped
+func Keywords(album, caption string) []string {
+	keywords := []string{}
+	seen := map[string]bool{}
+	add := func(keyword string) {
+		if keyword == "" || seen[strings.ToLower(keyword)] {
+			return
+		}
+		seen[strings.ToLower(keyword)] = true
+		keywords = append(keywords, keyword)
+	}
+	add(strings.TrimSpace(album))
+	for _, tag := range hashtag.FindAllString(caption, -1) {
+		add(strings.TrimPrefix(tag, "#"))
+	}
+	return keywords
+}
+
+// Title returns the first line of the caption
+func Title(caption string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(caption), "\n")
+	return strings.TrimSpace(title)
+}
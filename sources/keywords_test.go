@@ -0,0 +1,31 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		name    string
+		album   string
+		caption string
+		want    []string
+	}{
+		{name: "empty", want: []string{}},
+		{name: "album", album: " Summer ", want: []string{"Summer"}},
+		{name: "hashtags", album: "Summer", caption: "Sea #beach #море_2021,#Beach #summer", want: []string{"Summer", "beach", "море_2021"}},
+		{name: "no album", caption: "#sun", want: []string{"sun"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Keywords(tt.album, tt.caption))
+		})
+	}
+}
+
+func TestTitle(t *testing.T) {
+	assert.Equal(t, "", Title(""))
+	assert.Equal(t, "Sea", Title("  Sea \n#beach"))
+}
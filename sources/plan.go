@@ -0,0 +1,128 @@
+package sources
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+)
+
+// PlannedFile describes where a photo would be saved
+type PlannedFile struct {
+	PhotoID string `json:"photo_id"`
+	// AlbumDir is a dir of the file, it depends on the layout of the storage
+	AlbumDir string `json:"album_dir"`
+	Path     string `json:"path"`
+	// Size is -1 if it is unknown
+	Size int64 `json:"size"`
+}
+
+// Plan is a result of a dry run, it describes what a download would do
+type Plan struct {
+	Dir       string        `json:"dir"`
+	AlbumDirs []string      `json:"album_dirs"`
+	Files     []PlannedFile `json:"files"`
+	Photos    int           `json:"photos"`
+	// Skipped is a number of photos which are already saved or have no url
+	Skipped int `json:"skipped"`
+	// Filtered is a number of photos which don't match the filter
+	Filtered int `json:"filtered"`
+	// Bytes is an estimated size of all photos, photos of unknown size are not counted
+	Bytes       int64 `json:"bytes"`
+	UnknownSize int   `json:"unknown_size"`
+}
+
+// PlanAlbum walks photos of the album and returns what DownloadAlbum would do, nothing is written
+func (s *Social) PlanAlbum(ctx context.Context, albumID, dir string) (*Plan, error) {
+	return s.plan(ctx, dir, []string{albumID})
+}
+
+// PlanAllAlbums walks photos of all albums and returns what DownloadAllAlbums would do, nothing is written
+func (s *Social) PlanAllAlbums(ctx context.Context, dir string) (*Plan, error) {
+	albums, err := s.source.AllAlbums()
+	if err != nil {
+		return nil, err
+	}
+	albumIDs := make([]string, 0, len(albums))
+	for _, album := range albums {
+		// sources may leave nil entries for albums they skip
+		if album == nil || album["id"] == "" {
+			continue
+		}
+		albumIDs = append(albumIDs, album["id"])
+	}
+	return s.plan(ctx, dir, albumIDs)
+}
+
+func (s *Social) plan(ctx context.Context, dir string, albumIDs []string) (*Plan, error) {
+	rootDir, err := s.storage.DirPath(dir)
+	if err != nil {
+		return nil, &StorageError{text: "dir is invalid", err: err}
+	}
+	plan := &Plan{Dir: rootDir, AlbumDirs: []string{}, Files: []PlannedFile{}}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, maxConcurrentFiles)
+	)
+	for _, albumID := range albumIDs {
+		cur, err := s.source.AlbumPhotos(albumID)
+		if err != nil {
+			if len(albumIDs) == 1 {
+				return nil, &SourceError{text: "can't receive photos", err: err}
+			}
+			log.Println(err, "plan failed")
+			continue
+		}
+		for ctx.Err() == nil && cur.Next() {
+			photo := cur.Item()
+			if photo == nil || photo.Url() == "" || s.storage.Saved(rootDir, s.name, photo.ID()) {
+				plan.Skipped++
+				continue
+			}
+			if !s.filter.Match(photo) {
+				plan.Filtered++
+				continue
+			}
+			workers <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				file, err := s.storage.PlanPhoto(ctx, rootDir, s.album(photo), photo)
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				mu.Lock()
+				plan.Files = append(plan.Files, *file)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	albumDirs := map[string]bool{}
+	for _, file := range plan.Files {
+		if !albumDirs[file.AlbumDir] {
+			albumDirs[file.AlbumDir] = true
+			plan.AlbumDirs = append(plan.AlbumDirs, file.AlbumDir)
+		}
+		if file.Size < 0 {
+			plan.UnknownSize++
+		} else {
+			plan.Bytes += file.Size
+		}
+	}
+	sort.Strings(plan.AlbumDirs)
+	sort.Slice(plan.Files, func(i, k int) bool {
+		return plan.Files[i].Path < plan.Files[k].Path
+	})
+	plan.Photos = len(plan.Files)
+	return plan, nil
+}
@@ -0,0 +1,87 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// planStorage plans photos to dir/album/id.jpg, size of the photo "2" is unknown
+type planStorage struct {
+	countingStorage
+}
+
+func (s *planStorage) DirPath(dir string) (string, error) {
+	return "/root/" + dir, nil
+}
+
+func (s *planStorage) PlanPhoto(ctx context.Context, rootDir string, album Album, photo Photo) (*PlannedFile, error) {
+	size := int64(10)
+	if photo.ID() == "2" {
+		size = -1
+	}
+	albumDir := rootDir + "/" + album.Name
+	return &PlannedFile{PhotoID: photo.ID(), AlbumDir: albumDir, Path: albumDir + "/" + photo.ID() + ".jpg", Size: size}, nil
+}
+
+func TestSocial_PlanAlbum(t *testing.T) {
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumName: "b"},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumName: "a"},
+		&PhotoItem{id: "3", url: "https://example.com/3.jpg", albumName: "a"},
+		&PhotoItem{id: "4"},
+	}
+	storage := &planStorage{countingStorage{saved: map[string]bool{"3": true}}}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	got, err := s.PlanAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Equal(t, &Plan{
+		Dir:       "/root/dir",
+		AlbumDirs: []string{"/root/dir/a", "/root/dir/b"},
+		Files: []PlannedFile{
+			{PhotoID: "2", AlbumDir: "/root/dir/a", Path: "/root/dir/a/2.jpg", Size: -1},
+			{PhotoID: "1", AlbumDir: "/root/dir/b", Path: "/root/dir/b/1.jpg", Size: 10},
+		},
+		Photos:      2,
+		Skipped:     2,
+		Bytes:       10,
+		UnknownSize: 1,
+	}, got)
+	assert.Empty(t, storage.rootDirs(), "dry run must not create album dirs")
+	assert.Empty(t, storage.entries, "dry run must not record photos")
+
+	all, err := s.PlanAllAlbums(context.Background(), "dir")
+	assert.NoError(t, err)
+	assert.Equal(t, got, all)
+}
+
+func TestSocial_PlanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  Source
+		storage Storage
+	}{
+		{
+			name:    "storage error",
+			source:  &SourceTest{},
+			storage: &StorageTest{err: errors.New("error")},
+		},
+		{
+			name:    "source error",
+			source:  &SourceTest{err: errors.New("error")},
+			storage: &StorageTest{dir: "dir"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Social{name: "test", source: tt.source, storage: tt.storage}
+			_, err := s.PlanAlbum(context.Background(), "1", "dir")
+			assert.Error(t, err)
+			_, err = s.PlanAllAlbums(context.Background(), "dir")
+			assert.Error(t, err)
+		})
+	}
+}
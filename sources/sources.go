@@ -1,6 +1,8 @@
 package sources
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -16,10 +18,19 @@ const (
 var (
 	registeredSources  = map[string]func(creds string) Source{}
 	registeredStorages = map[string]func() Storage{}
-	photoCh            chan payload
+	// maxConcurrentFiles is a number of download workers
 	maxConcurrentFiles = 5
 )
 
+var (
+	// ErrFormatUnsupported is returned by SetExif if metadata can't be embedded into files of the format
+	ErrFormatUnsupported = errors.New("format doesn't support embedded metadata")
+	// ErrDirInvalid is returned by storages if a destination dir is malformed, e.g. it has ".."
+	ErrDirInvalid = errors.New("dir is invalid")
+	// ErrDirNotAllowed is returned by storages if a destination dir is outside of allowed roots
+	ErrDirNotAllowed = errors.New("dir is outside of allowed roots")
+)
+
 type StorageError struct {
 	text string
 	err  error
@@ -71,31 +82,138 @@ type Source interface {
 
 type ExifInfo interface {
 	Description() string
+	// Created is a creation date of the photo, the offset of Created is written as the timezone (OffsetTime)
 	Created() time.Time
+	// GPS is latitude and longitude, it is nil if the location is unknown
 	GPS() []float64
 }
 
+// HasLocation reports whether gps is a real location, sources may report 0,0 for photos without location
+func HasLocation(gps []float64) bool {
+	return len(gps) >= 2 && (gps[0] != 0 || gps[1] != 0)
+}
+
+// ExifDetails is implemented by ExifInfo which knows more about the photo, empty values are not written
+type ExifDetails interface {
+	Title() string
+	// Keywords are e.g. the album name and hashtags of the caption
+	Keywords() []string
+	// Author is a name or a username of the author
+	Author() string
+	// UniqueID is an ID of the original photo within the source
+	UniqueID() string
+}
+
 type Photo interface {
+	// ID is a unique ID of the photo within the source
+	ID() string
 	Url() string
+	// AlbumID is an ID of the album within the source, it tells apart albums with the same name
+	AlbumID() string
 	AlbumName() string
 	ExifInfo() (ExifInfo, error)
 }
 
+// Metadata describes a saved photo, it is written to sidecars of files
+type Metadata struct {
+	Source      string
+	PhotoID     string
+	URL         string
+	Album       string
+	Description string
+	Created     time.Time
+	// GPS is latitude and longitude, it is nil if the location is unknown
+	GPS      []float64
+	Title    string
+	Keywords []string
+	Author   string
+}
+
+// Album identifies an album of a source
+type Album struct {
+	Source string
+	ID     string
+	Name   string
+}
+
+func (s *Social) album(photo Photo) Album {
+	return Album{Source: s.name, ID: photo.AlbumID(), Name: photo.AlbumName()}
+}
+
 type payload struct {
-	photo   Photo
-	rootDir string
+	photo Photo
+	job   *Job
+}
+
+// File describes a photo written by a storage
+type File struct {
+	Path string
+	Size int64
+	// Hash is a hex encoded sha256 of the file content
+	Hash string
+	// DuplicateOf is a path of an already saved file of the same content, it is empty if the file is unique
+	DuplicateOf string
+}
+
+// ManifestEntry describes a photo saved to a destination, storages keep a manifest of these
+// so repeated downloads to the same destination skip photos which are already saved
+type ManifestEntry struct {
+	Source  string    `json:"source"`
+	PhotoID string    `json:"photo_id"`
+	URL     string    `json:"url"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Hash    string    `json:"hash"`
+	Saved   time.Time `json:"saved"`
+	// DuplicateOf is a path of a photo with the same content, it is relative to the root dir
+	DuplicateOf string `json:"duplicate_of,omitempty"`
 }
 
 type Storage interface {
 	Prepare(dir string) (string, error)
-	CreateAlbumDir(rootDir, dir string) (string, error)
-	DownloadPhoto(photoUrl, dir string) (string, error)
+	// DirPath resolves dir the same way as Prepare does, nothing is created
+	DirPath(dir string) (string, error)
+	// PreparePhoto creates dirs of the photo in rootDir and returns a path of its file, albums with the same name
+	// get different dirs and an album gets the same dir every time
+	PreparePhoto(rootDir string, album Album, photo Photo) (string, error)
+	// DownloadPhoto saves the photo to path, the returned File tells where it is actually saved
+	DownloadPhoto(ctx context.Context, photoUrl, path string) (*File, error)
+	// Deduplicate looks up a saved file of the same content in rootDir, the storage may replace the file
+	// with a link or remove it, the returned File tells where the photo is and what it duplicates.
+	// Record has to be called for the file afterwards, it becomes the original of its content then.
+	Deduplicate(rootDir string, file *File) (*File, error)
+	// SetExif embeds the info into the file, it returns an error wrapping ErrFormatUnsupported
+	// if the format of the file can't keep it
 	SetExif(filepath string, info ExifInfo) error
+	// WriteSidecar writes metadata next to the file if the storage is configured to do so,
+	// fallback makes it write the sidecar anyway
+	WriteSidecar(filepath string, meta Metadata, fallback bool) error
+	// Saved reports whether the photo of the source is already saved to rootDir
+	Saved(rootDir, source, photoID string) bool
+	// Record adds the saved photo to the manifest of rootDir
+	Record(rootDir string, entry ManifestEntry) error
+	// SaveReport writes a report of a job to rootDir
+	SaveReport(rootDir, name string, data []byte) error
+	// PlanPhoto returns where the photo would be saved in rootDir, nothing is written
+	PlanPhoto(ctx context.Context, rootDir string, album Album, photo Photo) (*PlannedFile, error)
+}
+
+// TimeSetter is implemented by storages which can set times of saved files
+type TimeSetter interface {
+	// SetTimes sets modification and access times of the file
+	SetTimes(filepath string, t time.Time) error
 }
 
 type Social struct {
+	name    string
 	source  Source
 	storage Storage
+	filter  *Filter
+}
+
+// SetFilter makes downloads and plans skip photos which don't match the filter, nil filter matches everything
+func (s *Social) SetFilter(filter *Filter) {
+	s.filter = filter
 }
 
 // Albums returns albums
@@ -107,74 +225,223 @@ func (s *Social) Albums() ([]map[string]string, error) {
 	return albums, nil
 }
 
-func (s *Social) DownloadAllAlbums(dir string) (string, error) {
+// DownloadAllAlbums runs copying process of all albums, returns a job tracking it
+func (s *Social) DownloadAllAlbums(ctx context.Context, dir string) (*Job, error) {
 	dir, err := s.storage.Prepare(dir)
 	if err != nil {
-		log.Println("DownloadAllAlbums(dir string)", err)
-		return "", &StorageError{text: "dir can't be created", err: err}
+		log.Println("DownloadAllAlbums(ctx, dir string)", err)
+		return nil, &StorageError{text: "dir can't be created", err: err}
 	}
 
 	albums, err := s.source.AllAlbums()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	job := s.startJob(ctx, dir)
 	for _, album := range albums {
-		go func(albumID string) {
-			_, err := s.DownloadAlbum(albumID, dir)
-			if err != nil {
-				log.Println(err, "DownloadAllAlbums failed")
+		// sources may leave nil entries for albums they skip
+		if album == nil || album["id"] == "" {
+			continue
+		}
+		job.beginFetch()
+		go func(albumID, title string) {
+			defer job.endFetch()
+			if job.wait() != nil {
+				return
 			}
-		}(album["id"])
+			s.fetchAlbum(job, albumID, title)
+		}(album["id"], album["title"])
 	}
-
-	return dir, nil
+	job.endFetch()
+	return job, nil
 }
 
-// DownloadAlbum runs copying process to a particular directory
-func (s *Social) DownloadAlbum(albumID, dir string) (string, error) {
+// DownloadAlbum runs copying process to a particular directory, returns a job tracking it
+func (s *Social) DownloadAlbum(ctx context.Context, albumID, dir string) (*Job, error) {
 	dir, err := s.storage.Prepare(dir)
 	if err != nil {
-		log.Println("DownloadAlbum(albumID, dir string)", err)
-		return "", &StorageError{text: "dir can't be created", err: err}
+		log.Println("DownloadAlbum(ctx, albumID, dir string)", err)
+		return nil, &StorageError{text: "dir can't be created", err: err}
 	}
 	cur, err := s.source.AlbumPhotos(albumID)
 	if err != nil {
-		return "", &SourceError{text: "can't receive photos", err: err}
+		return nil, &SourceError{text: "can't receive photos", err: err}
 	}
+	job := s.startJob(ctx, dir)
 	go func() {
-		for cur.Next() {
-			photoCh <- payload{photo: cur.Item(), rootDir: dir}
-		}
+		defer job.endFetch()
+		s.fetch(job, cur)
 	}()
-	return dir, nil
+	return job, nil
+}
+
+// startJob creates a job with its own download queue and workers, so photos of the job are saved
+// through the storage of s regardless of other jobs
+func (s *Social) startJob(ctx context.Context, dir string) *Job {
+	job := newJob(ctx, s.name, dir)
+	job.mu.Lock()
+	job.social = s
+	job.mu.Unlock()
+	for i := 0; i < maxConcurrentFiles; i++ {
+		go s.savePhotos(job.photos)
+	}
+	return job
 }
 
+// fetchAlbum pushes photos of the album to the download queue, the album is failed if its photos
+// can't be received
+func (s *Social) fetchAlbum(job *Job, albumID, title string) {
+	cur, err := s.source.AlbumPhotos(albumID)
+	if err != nil {
+		log.Println(err, "AlbumPhotos failed")
+		job.failAlbum(albumID, title, err)
+		return
+	}
+	s.fetch(job, cur)
+}
+
+// fetch pushes photos of the fetcher to the download queue until the job is canceled,
+// endFetch is called by the caller
+func (s *Social) fetch(job *Job, cur ItemFetcher) {
+	started := false
+	for job.wait() == nil && cur.Next() {
+		photo := cur.Item()
+		if photo != nil && !started {
+			started = true
+			job.albumStarted(photo)
+		}
+		if photo == nil || photo.Url() == "" || s.storage.Saved(job.Dir, job.Source, photo.ID()) {
+			job.skip()
+			continue
+		}
+		if !s.filter.Match(photo) {
+			job.exclude()
+			continue
+		}
+		job.queue()
+		select {
+		case job.photos <- payload{photo: photo, job: job}:
+		case <-job.ctx.Done():
+			job.drop()
+			return
+		}
+	}
+}
+
+// savePhotos is a download worker, it handles payloads one by one until photoCh is closed
 func (s *Social) savePhotos(photoCh chan payload) {
-	for file := range photoCh {
-		f := file
-		go func() {
-			dir, err := s.storage.CreateAlbumDir(f.rootDir, f.photo.AlbumName())
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			filepath, err := s.storage.DownloadPhoto(f.photo.Url(), dir)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			exif, err := f.photo.ExifInfo()
-			if err != nil {
-				log.Println(err)
-				return
+	for f := range photoCh {
+		s.savePhoto(f)
+	}
+}
+
+func (s *Social) savePhoto(f payload) {
+	if f.job.wait() != nil {
+		f.job.drop()
+		return
+	}
+	path, err := s.storage.PreparePhoto(f.job.Dir, s.album(f.photo), f.photo)
+	if err != nil {
+		log.Println(err)
+		f.job.fail(f.photo, StageAlbumDir, err)
+		return
+	}
+	release, err := downloads.acquire(f.job.ctx, f.photo.Url())
+	if err != nil {
+		f.job.drop()
+		return
+	}
+	saved, err := s.storage.DownloadPhoto(f.job.ctx, f.photo.Url(), path)
+	release()
+	if err != nil {
+		if f.job.ctx.Err() != nil {
+			f.job.drop()
+			return
+		}
+		log.Println(err)
+		f.job.fail(f.photo, StageDownload, err)
+		return
+	}
+	if deduplicated, err := s.storage.Deduplicate(f.job.Dir, saved); err != nil {
+		log.Println(err)
+		f.job.warn(f.photo, StageDedup, err)
+	} else {
+		saved = deduplicated
+	}
+	// the record makes the file an original for later duplicates, so it is recorded once its metadata
+	// is written, otherwise a hard link keeps the file which is replaced by SetExif
+	s.setMetadata(f, saved)
+	err = s.storage.Record(f.job.Dir, ManifestEntry{
+		Source:      f.job.Source,
+		PhotoID:     f.photo.ID(),
+		URL:         f.photo.Url(),
+		Path:        saved.Path,
+		Size:        saved.Size,
+		Hash:        saved.Hash,
+		Saved:       time.Now(),
+		DuplicateOf: saved.DuplicateOf,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	f.job.done(f.photo, saved)
+}
+
+// setMetadata writes metadata of the photo to the saved file and to its sidecar, failures are recorded by the job
+func (s *Social) setMetadata(f payload, saved *File) {
+	meta := Metadata{
+		Source:  f.job.Source,
+		PhotoID: f.photo.ID(),
+		URL:     f.photo.Url(),
+		Album:   f.photo.AlbumName(),
+	}
+	exif, err := f.photo.ExifInfo()
+	if err != nil {
+		log.Println(err)
+		f.job.warn(f.photo, StageExifInfo, err)
+	}
+	outcome := MetadataNone
+	var embedErr error
+	if err == nil && exif != nil {
+		meta.Description = exif.Description()
+		meta.Created = exif.Created()
+		if gps := exif.GPS(); HasLocation(gps) {
+			meta.GPS = gps
+		}
+		if details, ok := exif.(ExifDetails); ok {
+			meta.Title = details.Title()
+			meta.Keywords = details.Keywords()
+			meta.Author = details.Author()
+		}
+		outcome = MetadataEmbedded
+		// a duplicate shares the file with the original one, its metadata is kept
+		if saved.DuplicateOf != "" {
+			outcome = MetadataShared
+		} else if embedErr = s.storage.SetExif(saved.Path, exif); embedErr != nil {
+			outcome = MetadataSidecar
+			if !errors.Is(embedErr, ErrFormatUnsupported) {
+				f.job.warn(f.photo, StageSetExif, embedErr)
 			}
-			if exif == nil {
-				return
+		}
+	}
+	// a skipped duplicate has no file of its own
+	if saved.Path != saved.DuplicateOf {
+		if err := s.storage.WriteSidecar(saved.Path, meta, outcome == MetadataSidecar); err != nil {
+			log.Println(err)
+			f.job.warn(f.photo, StageSidecar, err)
+			if outcome == MetadataSidecar {
+				outcome = MetadataFailed
 			}
-			s.storage.SetExif(filepath, exif)
-		}()
+		}
+	}
+	// a duplicate shares the file or points to it, times of the original are kept
+	if setter, ok := s.storage.(TimeSetter); ok && !meta.Created.IsZero() && saved.DuplicateOf == "" {
+		if err := setter.SetTimes(saved.Path, meta.Created); err != nil {
+			log.Println(err)
+			f.job.warn(f.photo, StageSetTimes, err)
+		}
 	}
-	log.Println("channel closed")
+	f.job.metadataSaved(f.photo, saved.Path, outcome, embedErr)
 }
 
 // New creates a new instance of Social, you have to provide proper options
@@ -188,13 +455,10 @@ func New(sourceName, creds string) (*Social, error) {
 		return nil, err
 	}
 	s := &Social{
+		name:    sourceName,
 		storage: storage,
 		source:  source,
 	}
-	if photoCh == nil {
-		photoCh = make(chan payload, maxConcurrentFiles)
-		go s.savePhotos(photoCh)
-	}
 	return s, nil
 }
 
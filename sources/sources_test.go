@@ -1,7 +1,11 @@
 package sources
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,15 +13,23 @@ import (
 )
 
 type PhotoItem struct {
+	id        string
 	url       string
+	albumID   string
 	albumName string
 	exifInfo  ExifInfo
 	err       error
 }
 
+func (p *PhotoItem) ID() string {
+	return p.id
+}
 func (p *PhotoItem) Url() string {
 	return p.url
 }
+func (p *PhotoItem) AlbumID() string {
+	return p.albumID
+}
 func (p *PhotoItem) AlbumName() string {
 	return p.albumName
 }
@@ -26,31 +38,59 @@ func (p *PhotoItem) ExifInfo() (ExifInfo, error) {
 }
 
 type StorageTest struct {
-	dir               string
-	err               error
-	albumdir          string
-	createalbumdirErr error
-	downloadPhoto     string
-	downloadPhotoErr  error
-	setExifErr        error
+	dir              string
+	err              error
+	photoPath        string
+	preparePhotoErr  error
+	downloadPhoto    *File
+	downloadPhotoErr error
+	setExifErr       error
 }
 
 func (s *StorageTest) Prepare(dir string) (string, error) {
 	return s.dir, s.err
 }
 
-func (s *StorageTest) DownloadPhoto(photoUrl, dir string) (string, error) {
+func (s *StorageTest) DownloadPhoto(ctx context.Context, photoUrl, dir string) (*File, error) {
 	return s.downloadPhoto, s.downloadPhotoErr
 }
 
-func (s *StorageTest) CreateAlbumDir(rootDir, dir string) (string, error) {
-	return s.albumdir, s.createalbumdirErr
+func (s *StorageTest) PreparePhoto(rootDir string, album Album, photo Photo) (string, error) {
+	return s.photoPath, s.preparePhotoErr
+}
+
+func (s *StorageTest) Deduplicate(rootDir string, file *File) (*File, error) {
+	return file, nil
+}
+
+func (s *StorageTest) WriteSidecar(filepath string, meta Metadata, fallback bool) error {
+	return nil
 }
 
 func (s *StorageTest) SetExif(filepath string, data ExifInfo) error {
 	return s.setExifErr
 }
 
+func (s *StorageTest) Saved(rootDir, source, photoID string) bool {
+	return false
+}
+
+func (s *StorageTest) Record(rootDir string, entry ManifestEntry) error {
+	return nil
+}
+
+func (s *StorageTest) SaveReport(rootDir, name string, data []byte) error {
+	return nil
+}
+
+func (s *StorageTest) DirPath(dir string) (string, error) {
+	return s.dir, s.err
+}
+
+func (s *StorageTest) PlanPhoto(ctx context.Context, rootDir string, album Album, photo Photo) (*PlannedFile, error) {
+	return &PlannedFile{PhotoID: photo.ID(), AlbumDir: s.photoPath}, s.downloadPhotoErr
+}
+
 type testFetcher struct {
 	res bool
 }
@@ -64,6 +104,135 @@ func (tf *testFetcher) Item() Photo {
 	return &PhotoItem{}
 }
 
+type photosFetcher struct {
+	photos []Photo
+	cur    int
+}
+
+func (pf *photosFetcher) Next() bool {
+	pf.cur++
+	return pf.cur <= len(pf.photos)
+}
+
+func (pf *photosFetcher) Item() Photo {
+	return pf.photos[pf.cur-1]
+}
+
+// photosSource returns the same photos for any album
+type photosSource struct {
+	photos []Photo
+}
+
+func (source *photosSource) AllAlbums() ([]map[string]string, error) {
+	return []map[string]string{{"id": "1"}}, nil
+}
+
+func (source *photosSource) AlbumPhotos(albumdID string) (ItemFetcher, error) {
+	return &photosFetcher{photos: source.photos}, nil
+}
+
+// countingStorage records root dirs of saved photos
+type countingStorage struct {
+	StorageTest
+	mu      sync.Mutex
+	dirs    []string
+	saved   map[string]bool
+	entries []ManifestEntry
+	// failures is a number of failed downloads per url
+	failures map[string]int
+	reports  map[string][]byte
+	// duplicates maps hashes of duplicates to paths of their originals, a hash is a url of the photo
+	duplicates map[string]string
+	sidecars   []Metadata
+	// fallbacks are IDs of photos which sidecars are written as a fallback
+	fallbacks []string
+	// exifErrs are errors of SetExif per path
+	exifErrs map[string]error
+	// times are times set per path
+	times map[string]time.Time
+}
+
+func (s *countingStorage) WriteSidecar(filepath string, meta Metadata, fallback bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sidecars = append(s.sidecars, meta)
+	if fallback {
+		s.fallbacks = append(s.fallbacks, meta.PhotoID)
+	}
+	return nil
+}
+
+func (s *countingStorage) SetExif(filepath string, info ExifInfo) error {
+	return s.exifErrs[filepath]
+}
+
+func (s *countingStorage) SetTimes(filepath string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.times == nil {
+		s.times = map[string]time.Time{}
+	}
+	s.times[filepath] = t
+	return nil
+}
+
+func (s *countingStorage) Deduplicate(rootDir string, file *File) (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if original, ok := s.duplicates[file.Hash]; ok {
+		return &File{Path: file.Path, Size: file.Size, Hash: file.Hash, DuplicateOf: original}, nil
+	}
+	return file, nil
+}
+
+func (s *countingStorage) SaveReport(rootDir, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reports == nil {
+		s.reports = map[string][]byte{}
+	}
+	s.reports[name] = data
+	return nil
+}
+
+func (s *countingStorage) Saved(rootDir, source, photoID string) bool {
+	return s.saved[photoID]
+}
+
+func (s *countingStorage) Record(rootDir string, entry ManifestEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *countingStorage) Prepare(dir string) (string, error) {
+	return dir, nil
+}
+
+func (s *countingStorage) PreparePhoto(rootDir string, album Album, photo Photo) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs = append(s.dirs, rootDir)
+	return rootDir + "/" + photo.ID(), nil
+}
+
+func (s *countingStorage) DownloadPhoto(ctx context.Context, photoUrl, dir string) (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures[photoUrl] > 0 {
+		s.failures[photoUrl]--
+		return nil, errors.New("download failed")
+	}
+	return &File{Path: dir, Size: 1, Hash: photoUrl}, nil
+}
+
+func (s *countingStorage) rootDirs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dirs...)
+}
+
 type SourceTest struct {
 	albums []map[string]string
 	err    error
@@ -132,6 +301,7 @@ func TestNew(t *testing.T) {
 				storage:    storageTest,
 			},
 			want: &Social{
+				name:    "test",
 				source:  sourceTest,
 				storage: storageTest,
 			},
@@ -283,9 +453,14 @@ func TestSocial_DownloadAlbum(t *testing.T) {
 				source:  tt.fields.source,
 				storage: tt.fields.storage,
 			}
-			got, err := s.DownloadAlbum(tt.args.albumID, tt.args.dest)
+			got, err := s.DownloadAlbum(context.Background(), tt.args.albumID, tt.args.dest)
 			assert.Equal(t, tt.wantErr, err != nil)
-			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				assert.Nil(t, got)
+			} else {
+				assert.Equal(t, tt.want, got.Dir)
+				assert.NotEmpty(t, got.ID)
+			}
 		})
 	}
 }
@@ -358,9 +533,14 @@ func TestSocial_DownloadAllAlbums(t *testing.T) {
 				source:  tt.fields.source,
 				storage: tt.fields.storage,
 			}
-			got, err := s.DownloadAllAlbums(tt.args.dest)
+			got, err := s.DownloadAllAlbums(context.Background(), tt.args.dest)
 			assert.Equal(t, tt.wantErr, err != nil)
-			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				assert.Nil(t, got)
+			} else {
+				assert.Equal(t, tt.want, got.Dir)
+				assert.NotEmpty(t, got.ID)
+			}
 		})
 	}
 }
@@ -438,14 +618,14 @@ func TestSocial_savePhotos(t *testing.T) {
 			name: "no error",
 			fields: fields{
 				source:  &SourceTest{},
-				storage: &StorageTest{albumdir: "asd", downloadPhoto: "/tmp/photoD/asd.jpg"},
+				storage: &StorageTest{photoPath: "asd", downloadPhoto: &File{Path: "/tmp/photoD/asd.jpg"}},
 			},
 		},
 		{
 			name: "album error",
 			fields: fields{
 				source:  &SourceTest{},
-				storage: &StorageTest{createalbumdirErr: errors.New("something goes wrong")},
+				storage: &StorageTest{preparePhotoErr: errors.New("something goes wrong")},
 			},
 		},
 		{
@@ -459,7 +639,7 @@ func TestSocial_savePhotos(t *testing.T) {
 			name: "exif error",
 			fields: fields{
 				source:  &SourceTest{},
-				storage: &StorageTest{albumdir: "asd", downloadPhoto: "/tmp/photoD/asd.jpg"},
+				storage: &StorageTest{photoPath: "asd", downloadPhoto: &File{Path: "/tmp/photoD/asd.jpg"}},
 			},
 			args: args{exifErr: errors.New("something goes wrong")},
 		},
@@ -471,7 +651,9 @@ func TestSocial_savePhotos(t *testing.T) {
 				source:  tt.fields.source,
 				storage: tt.fields.storage,
 			}
-			tt.args.photoCh <- payload{photo: &PhotoItem{albumName: "album1", url: "https://example.com/asd.jpg", err: tt.args.exifErr}}
+			job := newJob(context.Background(), "test", "/tmp/photoD")
+			job.queue()
+			tt.args.photoCh <- payload{photo: &PhotoItem{albumName: "album1", url: "https://example.com/asd.jpg", err: tt.args.exifErr}, job: job}
 			go func() {
 				time.Sleep(1 * time.Second)
 				close(tt.args.photoCh)
@@ -481,6 +663,328 @@ func TestSocial_savePhotos(t *testing.T) {
 	}
 }
 
+func TestSocial_concurrentJobs(t *testing.T) {
+	first := &countingStorage{}
+	second := &countingStorage{}
+	photos := []Photo{&PhotoItem{url: "https://example.com/1.jpg"}, &PhotoItem{url: "https://example.com/2.jpg"}}
+	s1 := &Social{name: "test", source: &photosSource{photos: photos}, storage: first}
+	s2 := &Social{name: "test", source: &photosSource{photos: photos[:1]}, storage: second}
+
+	job1, err := s1.DownloadAlbum(context.Background(), "1", "dir1")
+	assert.NoError(t, err)
+	job2, err := s2.DownloadAlbum(context.Background(), "1", "dir2")
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return job1.Info().Status == JobFinished && job2.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"dir1", "dir1"}, first.rootDirs())
+	assert.Equal(t, []string{"dir2"}, second.rootDirs())
+}
+
+func TestSocial_DownloadAlbumSkipsSaved(t *testing.T) {
+	storage := &countingStorage{saved: map[string]bool{"1": true}}
+	photos := []Photo{&PhotoItem{id: "1", url: "https://example.com/1.jpg"}, &PhotoItem{id: "2", url: "https://example.com/2.jpg"}}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 1, info.Skipped)
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	assert.Len(t, storage.entries, 1)
+	assert.Equal(t, "2", storage.entries[0].PhotoID)
+	assert.Equal(t, "test", storage.entries[0].Source)
+}
+
+func TestSocial_RetryFailed(t *testing.T) {
+	storage := &countingStorage{failures: map[string]int{"https://example.com/2.jpg": 1}}
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg"},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumName: "album"},
+		&PhotoItem{id: "3", url: "https://example.com/3.jpg", err: errors.New("no exif")},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 2, info.Downloaded)
+	assert.Equal(t, 1, info.Failed)
+	assert.Equal(t, 2, info.FailedItems)
+
+	failures := job.Failures()
+	stages := map[string]string{}
+	fatal := map[string]bool{}
+	for _, item := range failures {
+		stages[item.PhotoID] = item.Stage
+		fatal[item.PhotoID] = item.Fatal
+	}
+	assert.Equal(t, map[string]string{"2": StageDownload, "3": StageExifInfo}, stages)
+	assert.Equal(t, map[string]bool{"2": true, "3": false}, fatal)
+
+	storage.mu.Lock()
+	report := storage.reports["failed-"+job.ID+".json"]
+	storage.mu.Unlock()
+	var saved []FailedItem
+	assert.NoError(t, json.Unmarshal(report, &saved))
+	assert.Len(t, saved, 2)
+
+	retry, err := job.Retry()
+	assert.NoError(t, err)
+	assert.NotEqual(t, job.ID, retry.ID)
+	assert.Eventually(t, func() bool {
+		return retry.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	// the photo without exif is saved, so it is not downloaded again
+	info = retry.Info()
+	assert.Equal(t, 1, info.Queued)
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 0, info.Failed)
+	assert.Equal(t, 0, info.FailedItems)
+}
+
+// albumsSource has an album per photo, photos of albums with errors can't be received until the error is removed
+type albumsSource struct {
+	mu     sync.Mutex
+	photos []Photo
+	errs   map[string]error
+}
+
+func (source *albumsSource) AllAlbums() ([]map[string]string, error) {
+	albums := []map[string]string{}
+	for _, photo := range source.photos {
+		albums = append(albums, map[string]string{"id": photo.AlbumID(), "title": photo.AlbumName()})
+	}
+	return albums, nil
+}
+
+func (source *albumsSource) AlbumPhotos(albumID string) (ItemFetcher, error) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if err := source.errs[albumID]; err != nil {
+		return nil, err
+	}
+	for _, photo := range source.photos {
+		if photo.AlbumID() == albumID {
+			return &photosFetcher{photos: []Photo{photo}}, nil
+		}
+	}
+	return &photosFetcher{}, nil
+}
+
+// sparseSource returns nil albums and albums without IDs besides the album of photos,
+// photos of an album without an ID can't be received
+type sparseSource struct {
+	photosSource
+}
+
+func (source *sparseSource) AllAlbums() ([]map[string]string, error) {
+	return []map[string]string{nil, {"title": "no id"}, {"id": "1"}}, nil
+}
+
+func (source *sparseSource) AlbumPhotos(albumID string) (ItemFetcher, error) {
+	if albumID == "" {
+		return nil, errors.New("album ID is empty")
+	}
+	return source.photosSource.AlbumPhotos(albumID)
+}
+
+func TestSocial_DownloadAllAlbumsSkipsEmptyAlbums(t *testing.T) {
+	photos := []Photo{&PhotoItem{id: "1", url: "https://example.com/1.jpg"}}
+	s := &Social{name: "test", source: &sparseSource{photosSource{photos: photos}}, storage: &countingStorage{}}
+
+	job, err := s.DownloadAllAlbums(context.Background(), "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 0, info.Failed)
+	assert.Empty(t, job.Failures())
+
+	plan, err := s.PlanAllAlbums(context.Background(), "dir")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.Photos)
+}
+
+func TestSocial_RetryFailedAlbum(t *testing.T) {
+	storage := &countingStorage{}
+	source := &albumsSource{
+		photos: []Photo{
+			&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumID: "a1", albumName: "a"},
+			&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumID: "b1", albumName: "b"},
+		},
+		errs: map[string]error{"b1": errors.New("too many requests")},
+	}
+	s := &Social{name: "test", source: source, storage: storage}
+
+	job, err := s.DownloadAllAlbums(context.Background(), "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 1, info.Failed)
+	assert.Equal(t, "too many requests", info.LastError)
+	failures := job.Failures()
+	assert.Len(t, failures, 1)
+	assert.Equal(t, "b1", failures[0].AlbumID)
+	assert.Equal(t, "b", failures[0].Album)
+	assert.Equal(t, StageAlbumPhotos, failures[0].Stage)
+	assert.True(t, failures[0].Fatal)
+	storage.mu.Lock()
+	assert.Contains(t, string(storage.reports["failed-"+job.ID+".json"]), `"album_id": "b1"`)
+	storage.mu.Unlock()
+	events, _ := job.EventsAfter(0)
+	types := []string{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Contains(t, types, EventAlbumFailed)
+
+	source.mu.Lock()
+	source.errs = nil
+	source.mu.Unlock()
+	retry, err := job.Retry()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return retry.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info = retry.Info()
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 0, info.Failed)
+}
+
+func TestSocial_DownloadAlbumFiltered(t *testing.T) {
+	storage := &countingStorage{}
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", exifInfo: &exifInfo{created: time.Now()}},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", exifInfo: &exifInfo{created: time.Now().AddDate(-1, 0, 0)}},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+	s.SetFilter(&Filter{CreatedAfter: time.Now().AddDate(0, 0, -1)})
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 1, info.Downloaded)
+	assert.Equal(t, 1, info.Filtered)
+}
+
+func TestSocial_DownloadAlbumDuplicates(t *testing.T) {
+	storage := &countingStorage{duplicates: map[string]string{"https://example.com/2.jpg": "dir/1.jpg"}}
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumName: "a"},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumName: "b"},
+		&PhotoItem{id: "3", url: "https://example.com/3.jpg", albumName: "b"},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	info := job.Info()
+	assert.Equal(t, 3, info.Downloaded)
+	assert.Equal(t, 1, info.Duplicates)
+	assert.Equal(t, map[string]AlbumStats{"a": {Downloaded: 1}, "b": {Downloaded: 2, Duplicates: 1}}, info.Albums)
+	for _, entry := range storage.entries {
+		if entry.PhotoID == "2" {
+			assert.Equal(t, "dir/1.jpg", entry.DuplicateOf)
+		} else {
+			assert.Empty(t, entry.DuplicateOf)
+		}
+	}
+}
+
+func TestSocial_DownloadAlbumSidecars(t *testing.T) {
+	storage := &countingStorage{}
+	created := time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC)
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumName: "a", exifInfo: &exifInfo{created: created, gps: []float64{1, 2}}},
+		&PhotoItem{id: "2", url: "https://example.com/2.jpg", albumName: "a", err: errors.New("no exif")},
+		&PhotoItem{id: "3", url: "https://example.com/3.jpg", albumName: "a", exifInfo: &detailedExif{title: "Sea", keywords: []string{"a", "sea"}}},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []Metadata{
+		{Source: "test", PhotoID: "1", URL: "https://example.com/1.jpg", Album: "a", Created: created, GPS: []float64{1, 2}},
+		{Source: "test", PhotoID: "2", URL: "https://example.com/2.jpg", Album: "a"},
+		{Source: "test", PhotoID: "3", URL: "https://example.com/3.jpg", Album: "a", Title: "Sea", Keywords: []string{"a", "sea"}, Author: "author"},
+	}, storage.sidecars)
+}
+
+func TestSocial_DownloadAlbumMetadata(t *testing.T) {
+	storage := &countingStorage{
+		duplicates: map[string]string{"https://example.com/4.jpg": "dir/1.jpg"},
+		exifErrs: map[string]error{
+			"dir/2": fmt.Errorf("SetExif: %w", ErrFormatUnsupported),
+			"dir/3": errors.New("broken"),
+		},
+	}
+	info := &exifInfo{created: time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC)}
+	photos := []Photo{
+		&PhotoItem{id: "1", url: "https://example.com/1.jpg", albumName: "a", exifInfo: info},
+		&PhotoItem{id: "2", url: "https://example.com/2.heic", albumName: "a", exifInfo: info},
+		&PhotoItem{id: "3", url: "https://example.com/3.jpg", albumName: "a", exifInfo: info},
+		&PhotoItem{id: "4", url: "https://example.com/4.jpg", albumName: "a", exifInfo: info},
+		&PhotoItem{id: "5", url: "https://example.com/5.jpg", albumName: "a", err: errors.New("no exif")},
+	}
+	s := &Social{name: "test", source: &photosSource{photos: photos}, storage: storage}
+
+	job, err := s.DownloadAlbum(context.Background(), "1", "dir")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return job.Info().Status == JobFinished
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]int{MetadataEmbedded: 1, MetadataSidecar: 2, MetadataShared: 1, MetadataNone: 1}, job.Info().Metadata)
+	assert.ElementsMatch(t, []string{"2", "3"}, storage.fallbacks)
+	outcomes := map[string]MetadataResult{}
+	for _, result := range job.Metadata() {
+		outcomes[result.PhotoID] = result
+	}
+	assert.Equal(t, MetadataResult{PhotoID: "2", Album: "a", Path: "dir/2", Outcome: MetadataSidecar, Error: "SetExif: format doesn't support embedded metadata"}, outcomes["2"])
+	// an unsupported format is expected, a broken file is reported
+	stages := []string{}
+	for _, item := range job.Failures() {
+		stages = append(stages, item.PhotoID+":"+item.Stage)
+	}
+	assert.ElementsMatch(t, []string{"3:" + StageSetExif, "5:" + StageExifInfo}, stages)
+	// all photos are saved, so nothing is retried
+	_, err = job.Retry()
+	assert.Error(t, err)
+	// times are set even if exif can't be embedded, a duplicate keeps times of the original
+	assert.Equal(t, map[string]time.Time{"dir/1": info.created, "dir/2": info.created, "dir/3": info.created}, storage.times)
+}
+
+func TestHasLocation(t *testing.T) {
+	assert.False(t, HasLocation(nil))
+	assert.False(t, HasLocation([]float64{0, 0}))
+	assert.False(t, HasLocation([]float64{55.7}))
+	assert.True(t, HasLocation([]float64{0, 37.6}))
+	assert.True(t, HasLocation([]float64{55.7, 37.6}))
+}
+
 func TestStorageError_Error(t *testing.T) {
 	tests := []struct {
 		name string
@@ -20,38 +20,81 @@ type Vk struct {
 	vkAPI *api.VK
 }
 
-// PhotoItem is a struct that contains a directory, a URL, a creation time, an album name, and a
+// PhotoItem is a struct that contains an ID, a URL, a creation time, an album name, and a
 // longitude and latitude.
 type PhotoItem struct {
+	id        string
 	url       string
 	created   time.Time
+	albumID   string
 	albumName string
+	// text is a caption of the photo
+	text string
+	// ownerID is negative for photos of communities
+	ownerID int
 	longitude,
 	latitude float64
+	width,
+	height int
+}
+
+func (f *PhotoItem) ID() string {
+	return f.id
 }
 
 func (f *PhotoItem) Url() string {
 	return f.url
 }
 
+func (f *PhotoItem) AlbumID() string {
+	return f.albumID
+}
+
 func (f *PhotoItem) AlbumName() string {
 	return f.albumName
 }
 
+func (f *PhotoItem) MediaType() string {
+	return sources.MediaImage
+}
+
+func (f *PhotoItem) Resolution() (width, height int) {
+	return f.width, f.height
+}
+
 // It's setting EXIF data for the downloaded file.
 func (f *PhotoItem) ExifInfo() (sources.ExifInfo, error) {
 	exif := &exifInfo{
 		description: fmt.Sprintf("Dumped by photoDumper. Source is vk. Album name: %s", f.albumName),
 		created:     f.created,
-		gps:         []float64{f.latitude, f.longitude},
+		title:       sources.Title(f.text),
+		keywords:    sources.Keywords(f.albumName, f.text),
+		author:      owner(f.ownerID),
+		uniqueID:    f.id,
+	}
+	// vk returns zero coordinates for photos without location
+	if gps := []float64{f.latitude, f.longitude}; sources.HasLocation(gps) {
+		exif.gps = gps
 	}
 	return exif, nil
 }
 
+// owner returns a screen name of the owner, it is a user or a community
+func owner(id int) string {
+	if id < 0 {
+		return fmt.Sprintf("club%d", -id)
+	}
+	return fmt.Sprintf("id%d", id)
+}
+
 type exifInfo struct {
 	description string
 	created     time.Time
 	gps         []float64
+	title       string
+	keywords    []string
+	author      string
+	uniqueID    string
 }
 
 func (e *exifInfo) Description() string {
@@ -66,6 +109,22 @@ func (e *exifInfo) GPS() []float64 {
 	return e.gps
 }
 
+func (e *exifInfo) Title() string {
+	return e.title
+}
+
+func (e *exifInfo) Keywords() []string {
+	return e.keywords
+}
+
+func (e *exifInfo) Author() string {
+	return e.author
+}
+
+func (e *exifInfo) UniqueID() string {
+	return e.uniqueID
+}
+
 // It creates a new Vk object, which is a wrapper around the vkAPI object
 func New(creds string) sources.Source {
 	return &Vk{vkAPI: api.NewVK(creds)}
@@ -99,6 +158,7 @@ type photoFetcher struct {
 	nextPhoto int
 	items     []object.PhotosPhoto
 	cur       int
+	albumID   string
 	albumName string
 }
 
@@ -140,29 +200,33 @@ func (v *Vk) AlbumPhotos(albumID string) (sources.ItemFetcher, error) {
 	if len(items) < 1 {
 		return nil, makeError(err, "DownloadAlbum failed")
 	}
-	return &photoFetcher{items: items, albumName: albumResp.Items[0].Title}, nil
+	return &photoFetcher{items: items, albumID: albumID, albumName: albumResp.Items[0].Title}, nil
 }
 
 func (pf *photoFetcher) Item() sources.Photo {
 	photo := pf.items[pf.cur]
-	var url string
-	if photo.MaxSize().URL == "" {
+	size := photo.MaxSize()
+	if size.URL == "" {
 		for _, s := range photo.Sizes {
 			if s.Type == "x" || s.Type == "y" || s.Type == "z" || s.Type == "w" {
-				url = s.URL
+				size = s
 			}
 		}
-	} else {
-		url = photo.MaxSize().URL
 	}
 
 	created := time.Unix(int64(photo.Date), 0)
 	return &PhotoItem{
-		url:       url,
+		id:        fmt.Sprintf("%d_%d", photo.OwnerID, photo.ID),
+		url:       size.URL,
 		created:   created,
+		albumID:   pf.albumID,
 		albumName: pf.albumName,
+		text:      photo.Text,
+		ownerID:   photo.OwnerID,
 		latitude:  photo.Lat,
 		longitude: photo.Long,
+		width:     int(size.Width),
+		height:    int(size.Height),
 	}
 }
 
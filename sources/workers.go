@@ -0,0 +1,73 @@
+package sources
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+var downloads = newLimiter(maxConcurrentFiles, 0)
+
+// SetWorkers sets a number of concurrent downloads and a limit of concurrent downloads from a single host,
+// perHost < 1 means no limit. It has to be called before the first download.
+func SetWorkers(workers, perHost int) {
+	if workers > 0 {
+		maxConcurrentFiles = workers
+	}
+	downloads = newLimiter(maxConcurrentFiles, perHost)
+}
+
+// limiter restricts a number of concurrent downloads of all jobs in total and per host
+type limiter struct {
+	total   chan struct{}
+	perHost int
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+}
+
+func newLimiter(total, perHost int) *limiter {
+	return &limiter{
+		total:   make(chan struct{}, total),
+		perHost: perHost,
+		hosts:   map[string]chan struct{}{},
+	}
+}
+
+// acquire blocks until a download from the host of photoUrl is allowed, release has to be called afterwards.
+// The slot of the host is taken first, so downloads waiting for a busy host don't hold slots of other hosts.
+func (l *limiter) acquire(ctx context.Context, photoUrl string) (release func(), err error) {
+	if l.perHost < 1 {
+		select {
+		case l.total <- struct{}{}:
+			return func() { <-l.total }, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	host := photoUrl
+	if u, err := url.Parse(photoUrl); err == nil {
+		host = u.Host
+	}
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = make(chan struct{}, l.perHost)
+		l.hosts[host] = slot
+	}
+	l.mu.Unlock()
+	select {
+	case slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case l.total <- struct{}{}:
+		return func() {
+			<-l.total
+			<-slot
+		}, nil
+	case <-ctx.Done():
+		<-slot
+		return nil, ctx.Err()
+	}
+}
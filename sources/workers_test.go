@@ -0,0 +1,113 @@
+package sources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetWorkers(t *testing.T) {
+	defer func(workers int, l *limiter) {
+		maxConcurrentFiles = workers
+		downloads = l
+	}(maxConcurrentFiles, downloads)
+
+	SetWorkers(10, 2)
+	assert.Equal(t, 10, maxConcurrentFiles)
+	assert.Equal(t, 10, cap(downloads.total))
+	assert.Equal(t, 2, downloads.perHost)
+
+	SetWorkers(0, 0)
+	assert.Equal(t, 10, maxConcurrentFiles)
+	assert.Equal(t, 0, downloads.perHost)
+}
+
+func Test_limiter_acquire(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		perHost   int
+		second    string
+		wantBlock bool
+	}{
+		{
+			name:      "no host limit",
+			total:     2,
+			perHost:   0,
+			second:    "https://example.com/2.jpg",
+			wantBlock: false,
+		},
+		{
+			name:      "total limit",
+			total:     1,
+			perHost:   0,
+			second:    "https://example.org/2.jpg",
+			wantBlock: true,
+		},
+		{
+			name:      "same host",
+			total:     2,
+			perHost:   1,
+			second:    "https://example.com/2.jpg",
+			wantBlock: true,
+		},
+		{
+			name:      "another host",
+			total:     2,
+			perHost:   1,
+			second:    "https://example.org/2.jpg",
+			wantBlock: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(tt.total, tt.perHost)
+			release, err := l.acquire(context.Background(), "https://example.com/1.jpg")
+			assert.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			secondRelease, err := l.acquire(ctx, tt.second)
+			assert.Equal(t, tt.wantBlock, err != nil)
+			if err == nil {
+				secondRelease()
+			}
+
+			release()
+			secondRelease, err = l.acquire(context.Background(), tt.second)
+			assert.NoError(t, err)
+			secondRelease()
+		})
+	}
+}
+
+func Test_limiter_acquireBusyHost(t *testing.T) {
+	l := newLimiter(2, 1)
+	release, err := l.acquire(context.Background(), "https://example.com/1.jpg")
+	assert.NoError(t, err)
+	defer release()
+
+	// a download waiting for the busy host doesn't take the last slot
+	waiting, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if release, err := l.acquire(waiting, "https://example.com/2.jpg"); err == nil {
+			release()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancelOther := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelOther()
+	other, err := l.acquire(ctx, "https://example.org/1.jpg")
+	assert.NoError(t, err)
+	if err == nil {
+		other()
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,131 @@
+package localfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// albumsName is a name of the file in the root dir which maps albums to their dirs
+const albumsName = "albums.json"
+
+var (
+	albumMaps   = map[string]*albumMap{}
+	albumMapsMu sync.Mutex
+)
+
+// albumMap keeps dirs of albums saved to a root dir, so an album gets the same dir on every run
+// and albums with the same name don't share a dir
+type albumMap struct {
+	rootDir string
+	mu      sync.Mutex
+	// dirs maps an album key to a dir name relative to the root dir
+	dirs map[string]string
+	// planned keeps dirs assigned by dry runs, they are never saved
+	planned map[string]string
+}
+
+func albumKey(album sources.Album) string {
+	return album.Source + "/" + album.ID
+}
+
+// loadAlbumMap reads the album map of rootDir once, subsequent calls return the cached one.
+// A missing file is not created.
+func loadAlbumMap(rootDir string) (*albumMap, error) {
+	albumMapsMu.Lock()
+	defer albumMapsMu.Unlock()
+	if m, ok := albumMaps[rootDir]; ok {
+		return m, nil
+	}
+	m := &albumMap{rootDir: rootDir, dirs: map[string]string{}, planned: map[string]string{}}
+	data, err := os.ReadFile(filepath.Join(rootDir, albumsName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("loadAlbumMap: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &m.dirs); err != nil {
+			return nil, fmt.Errorf("loadAlbumMap: %w", err)
+		}
+	}
+	albumMaps[rootDir] = m
+	return m, nil
+}
+
+// dir returns a dir name of the album. A new album gets its sanitized name, if the name is taken by another album
+// the album ID is appended. The dir of a new album is saved unless it is a dry run.
+func (m *albumMap) dir(album sources.Album, dryRun bool) (string, error) {
+	key := albumKey(album)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// a dir which is not a valid name is assigned again, the file might be edited by hand
+	if dir, ok := m.dirs[key]; ok && dir == sanitizeName(dir) {
+		return dir, nil
+	}
+	if dir, ok := m.planned[key]; ok && dryRun {
+		return dir, nil
+	}
+	name := album.Name
+	if strings.TrimSpace(name) == "" {
+		name = album.ID
+	}
+	name = sanitizeName(name)
+	id := sanitizeName(album.ID)
+	dir := name
+	for i := 1; m.taken(dir, dryRun); i++ {
+		dir = fmt.Sprintf("%s (%s)", name, id)
+		if i > 1 {
+			dir = fmt.Sprintf("%s (%s) %d", name, id, i)
+		}
+	}
+	if dryRun {
+		m.planned[key] = dir
+		return dir, nil
+	}
+	m.dirs[key] = dir
+	if err := m.save(); err != nil {
+		delete(m.dirs, key)
+		return "", err
+	}
+	return dir, nil
+}
+
+// taken reports whether the dir belongs to another album, dirs are compared case insensitively
+// as file systems of macOS and Windows are
+func (m *albumMap) taken(dir string, dryRun bool) bool {
+	for _, d := range m.dirs {
+		if strings.EqualFold(d, dir) {
+			return true
+		}
+	}
+	if dryRun {
+		for _, d := range m.planned {
+			if strings.EqualFold(d, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// save writes the map to a temporary file and renames it, so an interrupted write doesn't break it
+func (m *albumMap) save() error {
+	data, err := json.MarshalIndent(m.dirs, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.rootDir, albumsName)
+	if err := os.WriteFile(path+".tmp", data, 0640); err != nil {
+		return fmt.Errorf("albumMap: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("albumMap: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package localfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlbumMap(t *testing.T) {
+	rootDir := t.TempDir()
+	first := sources.Album{Source: "vk", ID: "1", Name: "Разное"}
+	second := sources.Album{Source: "vk", ID: "2", Name: "Разное"}
+
+	// a dry run assigns different dirs but doesn't save them
+	m, err := loadAlbumMap(rootDir)
+	assert.NoError(t, err)
+	dir, err := m.dir(second, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное", dir)
+	dir, err = m.dir(first, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное (1)", dir)
+	assert.NoFileExists(t, filepath.Join(rootDir, albumsName))
+
+	dir, err = m.dir(first, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное", dir)
+	dir, err = m.dir(second, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное (2)", dir)
+	assert.FileExists(t, filepath.Join(rootDir, albumsName))
+
+	// the mapping is stable when it is read again, the order of albums doesn't matter
+	albumMapsMu.Lock()
+	delete(albumMaps, rootDir)
+	albumMapsMu.Unlock()
+	m, err = loadAlbumMap(rootDir)
+	assert.NoError(t, err)
+	dir, err = m.dir(second, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное (2)", dir)
+	dir, err = m.dir(first, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Разное", dir)
+}
+
+func TestAlbumMap_broken(t *testing.T) {
+	rootDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(rootDir, albumsName), []byte("{broken"), 0640))
+	_, err := loadAlbumMap(rootDir)
+	assert.Error(t, err)
+}
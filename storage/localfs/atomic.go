@@ -0,0 +1,174 @@
+package localfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// partExt is an extension of temporary files of downloads and rewrites, they are hidden, named uniquely,
+// so concurrent jobs don't share them, and renamed into place when complete. Files left by crashes are
+// removed by removeStaleParts.
+const partExt = ".part"
+
+// stalePartAge is an age of temporary files which are considered to be left by crashes,
+// younger ones may be written by running jobs
+const stalePartAge = 24 * time.Hour
+
+// createTemp creates a unique hidden temporary file next to path
+func createTemp(path string) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+partExt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(0640); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// isPart reports whether name is a name of a temporary file
+func isPart(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, partExt)
+}
+
+// removeStaleParts removes temporary files older than stalePartAge in rootDir and its subdirs
+func removeStaleParts(rootDir string, now time.Time) {
+	filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isPart(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) > stalePartAge {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// verifyError is returned if a downloaded file doesn't match the size or the digest told by the server,
+// it is retried as the body is likely truncated
+type verifyError struct {
+	url  string
+	text string
+}
+
+func (e *verifyError) Error() string {
+	return fmt.Sprintf("%q is corrupted: %s", e.url, e.text)
+}
+
+// digests returns digests of the body told by Digest, Repr-Digest and Content-MD5 headers,
+// keys are "sha-256" and "md5"
+func digests(header http.Header) map[string][]byte {
+	result := map[string][]byte{}
+	if value := header.Get("Content-MD5"); value != "" {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+			result["md5"] = sum
+		}
+	}
+	for _, name := range []string{"Digest", "Repr-Digest"} {
+		for _, item := range strings.Split(header.Get(name), ",") {
+			algo, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			algo = strings.ToLower(algo)
+			if !ok || (algo != "sha-256" && algo != "md5") {
+				continue
+			}
+			// Repr-Digest wraps values in colons
+			if sum, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":")); err == nil {
+				result[algo] = sum
+			}
+		}
+	}
+	return result
+}
+
+// writeAtomic writes body to a temporary file next to path, verifies it against size (-1 if unknown)
+// and digests of the response, syncs it and renames it to path. Nothing is left at path if it fails.
+func writeAtomic(url, path string, body io.Reader, size int64, header http.Header) (file *sources.File, err error) {
+	tmp, err := createTemp(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	want := digests(header)
+	hashes := map[string]hash.Hash{"sha-256": sha256.New()}
+	if _, ok := want["md5"]; ok {
+		hashes["md5"] = md5.New()
+	}
+	writers := []io.Writer{tmp}
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	written, err := io.Copy(io.MultiWriter(writers...), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && written != size {
+		return nil, &verifyError{url: url, text: fmt.Sprintf("%d bytes of %d are received", written, size)}
+	}
+	for algo, sum := range want {
+		if !bytes.Equal(hashes[algo].Sum(nil), sum) {
+			return nil, &verifyError{url: url, text: algo + " digest mismatch"}
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	syncDir(filepath.Dir(path))
+	return &sources.File{Path: path, Size: written, Hash: hex.EncodeToString(hashes["sha-256"].Sum(nil))}, nil
+}
+
+// writeFileAtomic replaces the file at path with data, nothing is changed if it fails
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// syncDir makes the rename durable, it is not supported on Windows so errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
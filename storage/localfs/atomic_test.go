@@ -0,0 +1,140 @@
+package localfs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleStorage_DownloadPhotoVerified(t *testing.T) {
+	body := []byte("photo")
+	sha := sha256.Sum256(body)
+	md := md5.Sum(body)
+	tests := []struct {
+		name    string
+		header  map[string]string
+		body    []byte
+		wantErr bool
+	}{
+		{name: "no digest", body: body},
+		{name: "sha-256", header: map[string]string{"Digest": "sha-256=" + base64.StdEncoding.EncodeToString(sha[:])}, body: body},
+		{name: "repr digest", header: map[string]string{"Repr-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":"}, body: body},
+		{name: "content md5", header: map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md[:])}, body: body},
+		{name: "unknown algorithm", header: map[string]string{"Digest": "sha-512=AAAA"}, body: body},
+		{name: "sha-256 mismatch", header: map[string]string{"Digest": "sha-256=" + base64.StdEncoding.EncodeToString(sha[:])}, body: []byte("other"), wantErr: true},
+		{name: "md5 mismatch", header: map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md[:])}, body: []byte("other"), wantErr: true},
+		{name: "truncated", header: map[string]string{"Content-Length": "100"}, body: body, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range tt.header {
+					w.Header().Set(key, value)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+			dir := t.TempDir()
+			path := filepath.Join(dir, "1.jpg")
+			// a previous version of the file must survive a failed download
+			assert.NoError(t, os.WriteFile(path, []byte("old"), 0640))
+
+			file, err := (&SimpleStorage{}).DownloadPhoto(context.Background(), server.URL+"/1.jpg", path)
+			assert.Equal(t, tt.wantErr, err != nil)
+			content, _ := os.ReadFile(path)
+			if tt.wantErr {
+				assert.Equal(t, "old", string(content))
+			} else {
+				assert.Equal(t, path, file.Path)
+				assert.Equal(t, tt.body, content)
+			}
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1, "temporary files are removed")
+		})
+	}
+}
+
+func TestSimpleStorage_DownloadPhotoCorruptedRetried(t *testing.T) {
+	body := []byte("photo")
+	sha := sha256.Sum256(body)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sha[:]))
+		if calls == 1 {
+			w.Write([]byte("broken"))
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	s := NewWithOptions(WithRetries(1, time.Millisecond))
+	file, err := s.DownloadPhoto(context.Background(), server.URL+"/1.jpg", filepath.Join(t.TempDir(), "1.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, int64(len(body)), file.Size)
+}
+
+func Test_retryableVerifyError(t *testing.T) {
+	var e *verifyError
+	err := error(&verifyError{url: "url", text: "md5 digest mismatch"})
+	assert.True(t, retryable(err))
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, `"url" is corrupted: md5 digest mismatch`, err.Error())
+}
+
+func Test_writeAtomicConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "1.jpg")
+	bodies := []string{strings.Repeat("a", 4096), strings.Repeat("b", 4096)}
+	// two jobs save the same photo to the same claimed path
+	var wg sync.WaitGroup
+	for _, body := range bodies {
+		wg.Add(1)
+		go func(body string) {
+			defer wg.Done()
+			_, err := writeAtomic("url", path, iotest.OneByteReader(strings.NewReader(body)), int64(len(body)), http.Header{})
+			assert.NoError(t, err)
+		}(body)
+	}
+	wg.Wait()
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, bodies, string(content))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are removed")
+}
+
+func Test_removeStaleParts(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "album", ".1.jpg.123"+partExt)
+	fresh := filepath.Join(dir, "album", ".2.jpg.456"+partExt)
+	photo := filepath.Join(dir, "album", "3.jpg")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(stale), 0750))
+	for _, path := range []string{stale, fresh, photo} {
+		assert.NoError(t, os.WriteFile(path, []byte("photo"), 0640))
+	}
+	old := time.Now().Add(-2 * stalePartAge)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+	assert.NoError(t, os.Chtimes(photo, old, old))
+
+	removeStaleParts(dir, time.Now())
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh)
+	assert.FileExists(t, photo)
+}
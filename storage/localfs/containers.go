@@ -0,0 +1,215 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// image formats detected by magic bytes
+const (
+	formatJPEG    = "jpeg"
+	formatPNG     = "png"
+	formatWebP    = "webp"
+	formatUnknown = "unknown"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// detectFormat returns a format of the file by its magic bytes
+func detectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 12)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return formatJPEG, nil
+	case bytes.HasPrefix(head, pngSignature[:8]):
+		return formatPNG, nil
+	case len(head) == 12 && string(head[:4]) == "RIFF" && string(head[8:]) == "WEBP":
+		return formatWebP, nil
+	}
+	return formatUnknown, nil
+}
+
+// exifMerger returns a tiff structure of exif to write, existing is a tiff structure which the file has, it is nil
+// if the file has no exif
+type exifMerger func(existing []byte) ([]byte, error)
+
+// setPNGExif puts exif returned by merge into an eXIf chunk of the png, an existing eXIf chunk is replaced
+func setPNGExif(path string, merge exifMerger) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var chunks [][]byte
+	var existing []byte
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return errors.New("png is truncated")
+		}
+		size := binary.BigEndian.Uint32(rest[:4])
+		if uint64(size)+12 > uint64(len(rest)) {
+			return errors.New("png chunk is truncated")
+		}
+		if string(rest[4:8]) == "eXIf" {
+			existing = rest[8 : 8+size]
+		} else {
+			chunks = append(chunks, rest[:size+12])
+		}
+		rest = rest[size+12:]
+	}
+	payload, err := merge(existing)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	written := false
+	for _, chunk := range chunks {
+		// eXIf has to precede image data
+		if kind := string(chunk[4:8]); !written && (kind == "IDAT" || kind == "IEND") {
+			writePNGChunk(&out, "eXIf", payload)
+			written = true
+		}
+		out.Write(chunk)
+	}
+	if !written {
+		return errors.New("png has no image data")
+	}
+	return writeFileAtomic(path, out.Bytes())
+}
+
+func writePNGChunk(out *bytes.Buffer, kind string, payload []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(payload)
+	out.WriteString(kind)
+	out.Write(payload)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
+
+// webp flags of the VP8X chunk
+const (
+	webpFlagExif  = 0x08
+	webpFlagAlpha = 0x10
+)
+
+// setWebPExif puts exif returned by merge into an EXIF chunk of the webp, a simple webp is converted
+// to the extended format which is required for metadata, an existing EXIF chunk is replaced
+func setWebPExif(path string, merge exifMerger) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	type chunk struct {
+		kind    string
+		payload []byte
+	}
+	var chunks []chunk
+	var existing []byte
+	for rest := data[12:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return errors.New("webp is truncated")
+		}
+		size := binary.LittleEndian.Uint32(rest[4:8])
+		if uint64(size)+8 > uint64(len(rest)) {
+			return errors.New("webp chunk is truncated")
+		}
+		kind := string(rest[:4])
+		if kind == "EXIF" {
+			// some writers keep the header of the jpeg segment
+			existing = bytes.TrimPrefix(rest[8:8+size], []byte("Exif\x00\x00"))
+		} else {
+			chunks = append(chunks, chunk{kind: kind, payload: rest[8 : 8+size]})
+		}
+		rest = rest[min(uint64(len(rest)), uint64(size)+8+uint64(size%2)):]
+	}
+	if len(chunks) == 0 {
+		return errors.New("webp has no image data")
+	}
+	switch first := chunks[0]; first.kind {
+	case "VP8X":
+		if len(first.payload) < 10 {
+			return errors.New("webp VP8X chunk is truncated")
+		}
+		payload := append([]byte(nil), first.payload...)
+		payload[0] |= webpFlagExif
+		chunks[0].payload = payload
+	case "VP8 ", "VP8L":
+		width, height, alpha, err := webpSize(first.kind, first.payload)
+		if err != nil {
+			return err
+		}
+		payload := make([]byte, 10)
+		payload[0] = webpFlagExif
+		if alpha {
+			payload[0] |= webpFlagAlpha
+		}
+		putUint24(payload[4:], width-1)
+		putUint24(payload[7:], height-1)
+		chunks = append([]chunk{{kind: "VP8X", payload: payload}}, chunks...)
+	default:
+		return fmt.Errorf("webp chunk %q is unexpected", first.kind)
+	}
+	payload, err := merge(existing)
+	if err != nil {
+		return err
+	}
+	chunks = append(chunks, chunk{kind: "EXIF", payload: payload})
+
+	var body bytes.Buffer
+	for _, c := range chunks {
+		body.WriteString(c.kind)
+		binary.Write(&body, binary.LittleEndian, uint32(len(c.payload)))
+		body.Write(c.payload)
+		if len(c.payload)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+body.Len()))
+	out.WriteString("WEBP")
+	out.Write(body.Bytes())
+	return writeFileAtomic(path, out.Bytes())
+}
+
+// webpSize returns a canvas size of a simple webp by its bitstream
+func webpSize(kind string, payload []byte) (width, height uint32, alpha bool, err error) {
+	switch kind {
+	case "VP8 ":
+		if len(payload) < 10 || !bytes.Equal(payload[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, false, errors.New("webp VP8 frame is invalid")
+		}
+		width = uint32(binary.LittleEndian.Uint16(payload[6:8]) & 0x3fff)
+		height = uint32(binary.LittleEndian.Uint16(payload[8:10]) & 0x3fff)
+		return width, height, false, nil
+	default:
+		if len(payload) < 5 || payload[0] != 0x2f {
+			return 0, 0, false, errors.New("webp VP8L frame is invalid")
+		}
+		bits := binary.LittleEndian.Uint32(payload[1:5])
+		return bits&0x3fff + 1, (bits>>14)&0x3fff + 1, bits>>28&1 == 1, nil
+	}
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
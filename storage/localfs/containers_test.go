@@ -0,0 +1,146 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+// webpLossless is a 1x1 lossless webp
+var webpLossless = []byte{
+	0x52, 0x49, 0x46, 0x46, 0x1a, 0x00, 0x00, 0x00, 0x57, 0x45, 0x42, 0x50, 0x56, 0x50, 0x38, 0x4c,
+	0x0d, 0x00, 0x00, 0x00, 0x2f, 0x00, 0x00, 0x00, 0x10, 0x07, 0x10, 0x11, 0x11, 0x88, 0x88, 0xfe, 0x07, 0x00,
+}
+
+// pngChunks returns types of chunks of the png and their payloads by the types
+func pngChunks(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	kinds := []string{}
+	payloads := map[string][]byte{}
+	for rest := data[len(pngSignature):]; len(rest) >= 12; {
+		size := binary.BigEndian.Uint32(rest)
+		kinds = append(kinds, string(rest[4:8]))
+		payloads[string(rest[4:8])] = rest[8 : 8+size]
+		rest = rest[size+12:]
+	}
+	return kinds, payloads
+}
+
+// webpChunks returns payloads of chunks of the webp by their types
+func webpChunks(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+	kinds := []string{}
+	payloads := map[string][]byte{}
+	for rest := data[12:]; len(rest) >= 8; {
+		size := binary.LittleEndian.Uint32(rest[4:])
+		kinds = append(kinds, string(rest[:4]))
+		payloads[string(rest[:4])] = rest[8 : 8+size]
+		rest = rest[8+size+size%2:]
+	}
+	return kinds, payloads
+}
+
+func TestSimpleStorage_SetExifPNG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.png")
+	var b bytes.Buffer
+	assert.NoError(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 20, 30))))
+	assert.NoError(t, os.WriteFile(path, b.Bytes(), 0640))
+	s := &SimpleStorage{}
+
+	info := &ExifInfo{description: "first", created: time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC), gps: []float64{55.79, 49.12}}
+	assert.NoError(t, s.SetExif(path, info))
+	// the second call merges tags into the chunk, the date is kept by default
+	info.description = "second"
+	info.created = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, s.SetExif(path, info))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	kinds, payloads := pngChunks(t, data)
+	assert.Equal(t, []string{"IHDR", "eXIf", "IDAT", "IEND"}, kinds)
+	tags := exifTags(t, payloads["eXIf"])
+	assert.Equal(t, "second", tags["IFD/ImageDescription"])
+	assert.Equal(t, "2021:07:09 10:00:00", tags["IFD/DateTime"])
+	// crc is checked by the decoder
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 30), img.Bounds())
+}
+
+func TestSimpleStorage_SetExifWebP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.webp")
+	assert.NoError(t, os.WriteFile(path, webpLossless, 0640))
+	s := &SimpleStorage{}
+
+	info := &ExifInfo{description: "first"}
+	assert.NoError(t, s.SetExif(path, info))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	kinds, payloads := webpChunks(t, data)
+	assert.Equal(t, []string{"VP8X", "VP8L", "EXIF"}, kinds)
+	// the canvas is 1x1 as sizes are stored minus one, the bitstream tells it has alpha
+	assert.Equal(t, []byte{webpFlagExif | webpFlagAlpha, 0, 0, 0, 0, 0, 0, 0, 0, 0}, payloads["VP8X"])
+	assert.Equal(t, webpLossless[20:33], payloads["VP8L"])
+	assert.Equal(t, "first", exifTags(t, payloads["EXIF"])["IFD/ImageDescription"])
+
+	// the extended webp keeps its VP8X, the chunk is replaced
+	info.description = "second, an odd size"
+	assert.NoError(t, s.SetExif(path, info))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	kinds, payloads = webpChunks(t, data)
+	assert.Equal(t, []string{"VP8X", "VP8L", "EXIF"}, kinds)
+	assert.Equal(t, "second, an odd size", exifTags(t, payloads["EXIF"])["IFD/ImageDescription"])
+}
+
+func TestSimpleStorage_SetExifFormats(t *testing.T) {
+	dir := t.TempDir()
+	var b bytes.Buffer
+	assert.NoError(t, gif.Encode(&b, image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9), nil))
+	files := map[string][]byte{
+		"1.gif":  b.Bytes(),
+		"1.heic": []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"),
+		"2.png":  append(append([]byte(nil), pngSignature...), 0, 0, 0, 13, 'I', 'H', 'D', 'R'),
+		"2.webp": []byte("RIFF\x04\x00\x00\x00WEBP"),
+	}
+	for name, data := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0640))
+	}
+	tests := []struct {
+		name            string
+		path            string
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{name: "gif", path: "1.gif", wantErr: true, wantUnsupported: true},
+		{name: "heic", path: "1.heic", wantErr: true, wantUnsupported: true},
+		{name: "truncated png", path: "2.png", wantErr: true},
+		{name: "webp without image", path: "2.webp", wantErr: true},
+		{name: "nonexistent", path: "3.png", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.path)
+			err := (&SimpleStorage{}).SetExif(path, &ExifInfo{description: "a"})
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantUnsupported, errors.Is(err, sources.ErrFormatUnsupported))
+			// a failed file is kept as is
+			if data, ok := files[tt.path]; ok {
+				got, _ := os.ReadFile(path)
+				assert.Equal(t, data, got)
+			}
+		})
+	}
+}
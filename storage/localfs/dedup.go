@@ -0,0 +1,96 @@
+package localfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// DedupMode tells what the storage does with a downloaded photo which has the same content as a saved one
+type DedupMode string
+
+const (
+	// DedupOff keeps duplicates as separate files
+	DedupOff DedupMode = "off"
+	// DedupHardlink replaces a duplicate with a hard link to the saved file
+	DedupHardlink DedupMode = "hardlink"
+	// DedupSymlink replaces a duplicate with a relative symbolic link to the saved file
+	DedupSymlink DedupMode = "symlink"
+	// DedupSkip removes a duplicate, the photo is recorded with the path of the saved file
+	DedupSkip DedupMode = "skip"
+)
+
+// ParseDedupMode returns the mode by its name
+func ParseDedupMode(name string) (DedupMode, error) {
+	switch mode := DedupMode(name); mode {
+	case DedupOff, DedupHardlink, DedupSymlink, DedupSkip:
+		return mode, nil
+	}
+	return "", fmt.Errorf("dedup mode %q is unknown, it is one of %s, %s, %s, %s", name, DedupOff, DedupHardlink, DedupSymlink, DedupSkip)
+}
+
+// WithDedup sets a mode of deduplication, DedupOff is used by default
+func WithDedup(mode DedupMode) Option {
+	return func(s *SimpleStorage) {
+		s.dedup = mode
+	}
+}
+
+// Deduplicate looks up a file of the same content in the manifest of rootDir, the index is kept by sha256
+// of downloaded content. A duplicate is replaced according to the dedup mode, the file is returned as is
+// if dedup is off or the content is new. A file of new content becomes the original once it is recorded,
+// duplicates found meanwhile wait for it, so Record has to be called for every deduplicated file.
+func (s *SimpleStorage) Deduplicate(rootDir string, file *sources.File) (*sources.File, error) {
+	if s.dedup == "" || s.dedup == DedupOff || file.Hash == "" {
+		return file, nil
+	}
+	m, err := loadManifest(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	original, ok := m.original(file.Hash, file.Path)
+	if !ok {
+		return file, nil
+	}
+	duplicate := *file
+	duplicate.DuplicateOf = original
+	switch s.dedup {
+	case DedupHardlink:
+		err = replace(file.Path, func(tmp string) error { return os.Link(original, tmp) })
+	case DedupSymlink:
+		target, relErr := filepath.Rel(filepath.Dir(file.Path), original)
+		if relErr != nil {
+			return nil, relErr
+		}
+		err = replace(file.Path, func(tmp string) error { return os.Symlink(target, tmp) })
+	case DedupSkip:
+		err = os.Remove(file.Path)
+		duplicate.Path = original
+	}
+	if err != nil {
+		return nil, fmt.Errorf("deduplicate: %w", err)
+	}
+	return &duplicate, nil
+}
+
+// replace atomically replaces path with a link created by link, the link is created at a unique temporary name
+func replace(path string, link func(tmp string) error) error {
+	// links can't be created over a file, so the name of a removed temporary file is taken
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	os.Remove(tmp)
+	if err := link(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
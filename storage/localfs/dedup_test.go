@@ -0,0 +1,142 @@
+package localfs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDedupMode(t *testing.T) {
+	for _, name := range []string{"off", "hardlink", "symlink", "skip"} {
+		mode, err := ParseDedupMode(name)
+		assert.NoError(t, err)
+		assert.Equal(t, DedupMode(name), mode)
+	}
+	_, err := ParseDedupMode("copy")
+	assert.Error(t, err)
+}
+
+func TestSimpleStorage_Deduplicate(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      DedupMode
+		wantDup   bool
+		wantPath  string
+		wantLink  bool
+		wantExist bool
+	}{
+		{name: "off", mode: DedupOff, wantPath: "b/2.jpg", wantExist: true},
+		{name: "hardlink", mode: DedupHardlink, wantDup: true, wantPath: "b/2.jpg", wantExist: true},
+		{name: "symlink", mode: DedupSymlink, wantDup: true, wantPath: "b/2.jpg", wantLink: true, wantExist: true},
+		{name: "skip", mode: DedupSkip, wantDup: true, wantPath: "a/1.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			s := NewWithOptions(WithDedup(tt.mode))
+			save := func(rel, content string) *sources.File {
+				path := filepath.Join(rootDir, rel)
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+				assert.NoError(t, os.WriteFile(path, []byte(content), 0640))
+				return &sources.File{Path: path, Size: int64(len(content)), Hash: "hash-" + content}
+			}
+
+			first, err := s.Deduplicate(rootDir, save("a/1.jpg", "photo"))
+			assert.NoError(t, err)
+			assert.Empty(t, first.DuplicateOf)
+			assert.NoError(t, s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: "1", Path: first.Path, Hash: first.Hash}))
+
+			unique, err := s.Deduplicate(rootDir, save("b/3.jpg", "other"))
+			assert.NoError(t, err)
+			assert.Empty(t, unique.DuplicateOf)
+
+			// the index is read from the manifest in the next run
+			manifestsMu.Lock()
+			delete(manifests, rootDir)
+			manifestsMu.Unlock()
+			second, err := s.Deduplicate(rootDir, save("b/2.jpg", "photo"))
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(rootDir, tt.wantPath), second.Path)
+			if !tt.wantDup {
+				assert.Empty(t, second.DuplicateOf)
+				return
+			}
+			assert.Equal(t, first.Path, second.DuplicateOf)
+			assert.NoError(t, s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: "2", Path: second.Path, Hash: second.Hash, DuplicateOf: second.DuplicateOf}))
+			assert.True(t, s.Saved(rootDir, "vk", "2"))
+
+			dupPath := filepath.Join(rootDir, "b", "2.jpg")
+			info, err := os.Lstat(dupPath)
+			if !tt.wantExist {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLink, info.Mode()&os.ModeSymlink != 0)
+			content, err := os.ReadFile(dupPath)
+			assert.NoError(t, err)
+			assert.Equal(t, "photo", string(content))
+			originalInfo, err := os.Stat(first.Path)
+			assert.NoError(t, err)
+			dupInfo, err := os.Stat(dupPath)
+			assert.NoError(t, err)
+			assert.True(t, os.SameFile(originalInfo, dupInfo))
+		})
+	}
+}
+
+func TestSimpleStorage_DeduplicateOriginalRemoved(t *testing.T) {
+	rootDir := t.TempDir()
+	s := NewWithOptions(WithDedup(DedupSkip))
+	first := filepath.Join(rootDir, "1.jpg")
+	second := filepath.Join(rootDir, "2.jpg")
+	assert.NoError(t, os.WriteFile(second, []byte("photo"), 0640))
+	assert.NoError(t, s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: "1", Path: first, Hash: "hash"}))
+
+	file, err := s.Deduplicate(rootDir, &sources.File{Path: second, Hash: "hash"})
+	assert.NoError(t, err)
+	assert.Empty(t, file.DuplicateOf)
+	assert.FileExists(t, second)
+}
+
+func TestSimpleStorage_DeduplicateConcurrent(t *testing.T) {
+	rootDir := t.TempDir()
+	s := NewWithOptions(WithDedup(DedupHardlink))
+	paths := []string{filepath.Join(rootDir, "a", "1.jpg"), filepath.Join(rootDir, "b", "2.jpg")}
+	for _, path := range paths {
+		writeJPEG(t, path)
+	}
+	data, err := os.ReadFile(paths[0])
+	assert.NoError(t, err)
+	hash := "hash-" + string(data)
+
+	// copies of the same content are saved by two workers like sources.Social.savePhoto does
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(id, path string) {
+			defer wg.Done()
+			file, err := s.Deduplicate(rootDir, &sources.File{Path: path, Size: int64(len(data)), Hash: hash})
+			assert.NoError(t, err)
+			if file.DuplicateOf == "" {
+				// the other copy is deduplicated while the original is being rewritten
+				time.Sleep(50 * time.Millisecond)
+				assert.NoError(t, s.SetExif(file.Path, &ExifInfo{description: "sea"}))
+			}
+			assert.NoError(t, s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: id, Path: file.Path, Hash: file.Hash, DuplicateOf: file.DuplicateOf}))
+		}(strconv.Itoa(i+1), path)
+	}
+	wg.Wait()
+
+	first, err := os.Stat(paths[0])
+	assert.NoError(t, err)
+	second, err := os.Stat(paths[1])
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(first, second))
+}
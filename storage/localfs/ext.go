@@ -0,0 +1,73 @@
+package localfs
+
+import (
+	"bufio"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is a number of bytes http.DetectContentType considers
+const sniffLen = 512
+
+// extensions of media types of photos and videos
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/heic":      ".heic",
+	"image/heif":      ".heif",
+	"image/bmp":       ".bmp",
+	"image/tiff":      ".tiff",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+}
+
+// contentExt returns an extension of the response body by its Content-Type,
+// magic bytes of the body are used if the header is missing or unknown.
+// It returns "" if the type is unknown.
+func contentExt(resp *http.Response, body *bufio.Reader) string {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		if ext, ok := extensions[strings.ToLower(mediaType)]; ok {
+			return ext
+		}
+	}
+	head, _ := body.Peek(sniffLen)
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return extensions[mediaType]
+}
+
+// knownExt reports whether ext is an extension of a photo or a video
+func knownExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	if ext == ".jpeg" || ext == ".tif" {
+		return true
+	}
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// stem returns path without an extension of a photo or a video, other extensions are kept,
+// so an ID like "1.5" is not cut
+func stem(path string) string {
+	if knownExt(filepath.Ext(path)) {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// withExt sets ext as an extension of path, path is returned as is if ext is unknown or path has an alias of it
+func withExt(path, ext string) string {
+	current := strings.ToLower(filepath.Ext(path))
+	if ext == "" || current == ext || (current == ".jpeg" && ext == ".jpg") || (current == ".tif" && ext == ".tiff") {
+		return path
+	}
+	return stem(path) + ext
+}
@@ -0,0 +1,103 @@
+package localfs
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleStorage_DownloadPhotoExt(t *testing.T) {
+	var pngImage bytes.Buffer
+	assert.NoError(t, png.Encode(&pngImage, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		path        string
+		want        string
+	}{
+		{name: "content type", contentType: "image/png", body: []byte("png"), path: "1.jpg", want: "1.png"},
+		{name: "content type with params", contentType: "video/mp4; codecs=avc1", body: []byte("mp4"), path: "1.jpg", want: "1.mp4"},
+		{name: "magic bytes", contentType: "application/octet-stream", body: pngImage.Bytes(), path: "1.jpg", want: "1.png"},
+		{name: "same ext", contentType: "image/jpeg", body: []byte("jpg"), path: "1.jpg", want: "1.jpg"},
+		{name: "alias", contentType: "image/jpeg", body: []byte("jpg"), path: "1.jpeg", want: "1.jpeg"},
+		{name: "no ext", contentType: "image/png", body: []byte("png"), path: "1", want: "1.png"},
+		{name: "dot in id", contentType: "image/png", body: []byte("png"), path: "1.5", want: "1.5.png"},
+		{name: "unknown type", contentType: "application/octet-stream", body: []byte("text"), path: "1.jpg", want: "1.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+			dir := t.TempDir()
+			file, err := (&SimpleStorage{}).DownloadPhoto(context.Background(), server.URL+"/photo", filepath.Join(dir, tt.path))
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(dir, tt.want), file.Path)
+			content, err := os.ReadFile(file.Path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.body, content)
+		})
+	}
+}
+
+func TestSimpleStorage_PreparePhotoCollisions(t *testing.T) {
+	rootDir := t.TempDir()
+	layout, err := NewLayout("{album}/{filename}")
+	assert.NoError(t, err)
+	s := NewWithOptions(WithLayout(layout))
+	album := sources.Album{Source: "vk", ID: "1", Name: "album"}
+	assert.NoError(t, os.MkdirAll(filepath.Join(rootDir, "album"), 0750))
+	assert.NoError(t, os.WriteFile(filepath.Join(rootDir, "album", "unknown.jpg"), []byte("mine"), 0640))
+	tests := []struct {
+		name   string
+		photo  sources.Photo
+		dryRun bool
+		want   string
+	}{
+		{name: "planned", photo: &photoItem{id: "1", url: "https://cdn1.example.com/photo.jpg"}, dryRun: true, want: "photo.jpg"},
+		{name: "planned collision", photo: &photoItem{id: "2", url: "https://cdn2.example.com/photo.jpg"}, dryRun: true, want: "photo_2.jpg"},
+		{name: "new", photo: &photoItem{id: "1", url: "https://cdn1.example.com/photo.jpg"}, want: "photo.jpg"},
+		{name: "same photo", photo: &photoItem{id: "1", url: "https://cdn1.example.com/photo.jpg"}, want: "photo.jpg"},
+		{name: "same basename", photo: &photoItem{id: "2", url: "https://cdn2.example.com/photo.jpg"}, want: "photo_2.jpg"},
+		{name: "differs in case and ext", photo: &photoItem{id: "3", url: "https://cdn3.example.com/PHOTO.png"}, want: "PHOTO_3.png"},
+		{name: "unknown file", photo: &photoItem{id: "4", url: "https://cdn3.example.com/unknown.jpg"}, want: "unknown_2.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.dryRun {
+				planned, err := s.PlanPhoto(context.Background(), rootDir, album, tt.photo)
+				assert.NoError(t, err)
+				path = planned.Path
+			} else {
+				path, err = s.PreparePhoto(rootDir, album, tt.photo)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, filepath.Join(rootDir, "album", tt.want), path)
+		})
+	}
+
+	// saved photos keep their paths when the manifest is read again
+	assert.NoError(t, s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: "2", Path: filepath.Join(rootDir, "album", "photo_2.jpg")}))
+	manifestsMu.Lock()
+	delete(manifests, rootDir)
+	manifestsMu.Unlock()
+	path, err := s.PreparePhoto(rootDir, album, &photoItem{id: "2", url: "https://cdn2.example.com/photo.jpg"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootDir, "album", "photo_2.jpg"), path)
+	path, err = s.PreparePhoto(rootDir, album, &photoItem{id: "5", url: "https://cdn5.example.com/photo_2.jpg"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(rootDir, "album", "photo_2_2.jpg"), path)
+}
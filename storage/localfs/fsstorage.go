@@ -1,45 +1,102 @@
 package localfs
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/Gasoid/photoDumper/sources"
-	exif "github.com/Gasoid/simpleGoExif"
+	exif "github.com/dsoprea/go-exif/v2"
 )
 
 type SimpleStorage struct {
+	// retries is a number of retries of a failed download
+	retries int
+	// retryDelay is a delay before the first retry
+	retryDelay time.Duration
+	// layout tells where photos are saved, DefaultLayout if nil
+	layout *Layout
+	// dedup tells what to do with duplicates, DedupOff if empty
+	dedup DedupMode
+	// sidecars tells whether XMP sidecars are written next to files
+	sidecars bool
+	// merge overrides default merge policies of tags
+	merge map[string]MergePolicy
+	// roots are dirs destinations are allowed within, any dir is allowed if it is empty
+	roots []string
 }
 
-// It's a method of Social struct. It's checking if the path is absolute or relative.
-func (s *SimpleStorage) dirPath(dir string) (string, error) {
+// DirPath checks if the path is absolute or relative and expands ~, nothing is created.
+// Dirs with ".." are rejected by sources.ErrDirInvalid, dirs outside of allowed roots by sources.ErrDirNotAllowed.
+func (s *SimpleStorage) DirPath(dir string) (string, error) {
 	if len(dir) < 1 {
-		return "", fmt.Errorf("len of dir is less 1")
+		return "", fmt.Errorf("len of dir is less 1: %w", sources.ErrDirInvalid)
 	}
-	if dir[:1] == "~" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
-		}
-		dir = filepath.Join(home, filepath.FromSlash(dir[1:]))
+	if hasDotDot(dir) {
+		return "", fmt.Errorf("%s has \"..\": %w", dir, sources.ErrDirInvalid)
 	}
-	return dir, nil
+	dir, err := expandHome(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(s.roots) == 0 {
+		return dir, nil
+	}
+	return s.allowedDir(dir)
 }
 
 func (s *SimpleStorage) Prepare(dir string) (string, error) {
-	dir, err := s.dirPath(dir)
+	dir, err := s.DirPath(dir)
 	if err != nil {
 		log.Println("prepareDir", err)
 		return "", err
 	}
 	err = os.MkdirAll(dir, 0750)
-	return dir, err
+	if err != nil {
+		return dir, err
+	}
+	removeStaleParts(dir, time.Now())
+	m, err := loadManifest(dir)
+	if err != nil {
+		return dir, err
+	}
+	return dir, m.create()
+}
+
+// Saved reports whether the photo is recorded in the manifest of rootDir
+func (s *SimpleStorage) Saved(rootDir, source, photoID string) bool {
+	m, err := loadManifest(rootDir)
+	if err != nil {
+		log.Println("Saved", err)
+		return false
+	}
+	return m.saved(source, photoID)
+}
+
+// Record adds the saved photo to the manifest of rootDir
+func (s *SimpleStorage) Record(rootDir string, entry sources.ManifestEntry) error {
+	m, err := loadManifest(rootDir)
+	if err != nil {
+		return err
+	}
+	return m.add(entry)
+}
+
+// SaveReport writes a report of a job to rootDir
+func (s *SimpleStorage) SaveReport(rootDir, name string, data []byte) error {
+	err := os.WriteFile(filepath.Join(rootDir, filepath.Base(name)), data, 0640)
+	if err != nil {
+		return fmt.Errorf("SaveReport: %w", err)
+	}
+	return nil
 }
 
 // It takes a URL, parses it, and returns the base name of the path
@@ -47,94 +104,193 @@ func (s *SimpleStorage) FilePath(dir, filename string) string {
 	return filepath.Join(dir, filename)
 }
 
-func filename(path string) (string, error) {
-	u, err := url.Parse(path)
+// filename returns a sanitized base name of the url path
+func filename(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
 		return "", err
 	}
-	name := filepath.Base(u.Path)
+	name := sanitizeName(path.Base(u.Path))
 	if filepath.Ext(name) == "" {
 		return "", errors.New("no ext")
 	}
 	return name, nil
 }
 
-func (s *SimpleStorage) CreateAlbumDir(rootDir, albumName string) (string, error) {
-	albumDir := filepath.Join(rootDir, albumName)
-	err := os.MkdirAll(albumDir, 0750)
+// photoPath returns a path of the photo in rootDir according to the layout. The {album} placeholder is
+// a dir name of the album recorded in albums.json of rootDir, so the album gets the same name next time,
+// see albumMap.
+func (s *SimpleStorage) photoPath(rootDir string, album sources.Album, photo sources.Photo, dryRun bool) (string, error) {
+	m, err := loadAlbumMap(rootDir)
+	if err != nil {
+		return "", err
+	}
+	albumDir, err := m.dir(album, dryRun)
+	if err != nil {
+		return "", err
+	}
+	name, err := filename(photo.Url())
+	if err != nil {
+		// the url doesn't tell a name, the photo is named by its ID
+		name = photo.ID()
+	}
+	vars := &photoVars{album: album, albumDir: albumDir, photo: photo, filename: name}
+	if exif, err := photo.ExifInfo(); err == nil && exif != nil {
+		vars.created = exif.Created()
+	}
+	layout := s.layout
+	if layout == nil {
+		layout = defaultLayout
+	}
+	manifest, err := loadManifest(rootDir)
+	if err != nil {
+		return "", err
+	}
+	// the path fits MAX_PATH of Windows with the root dir, a separator and the reserve
+	relMax := maxPathLen - units(rootDir) - 1 - pathReserve
+	return manifest.claim(filepath.Join(rootDir, layout.path(vars, relMax)), album.Source, photo.ID(), dryRun), nil
+}
+
+// PreparePhoto creates dirs of the photo in rootDir according to the layout and returns a path of its file
+func (s *SimpleStorage) PreparePhoto(rootDir string, album sources.Album, photo sources.Photo) (string, error) {
+	path, err := s.photoPath(rootDir, album, photo, false)
 	if err != nil {
-		return "", fmt.Errorf("createAlbumDir: %w", err)
+		return "", fmt.Errorf("preparePhoto: %w", err)
 	}
-	return albumDir, nil
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return "", fmt.Errorf("preparePhoto: %w", err)
+	}
+	return path, nil
 }
 
-// It downloads the file from the url, creates a file with the name of the file, and writes the body of
-// the response to the file
-func (s *SimpleStorage) DownloadPhoto(url, dir string) (string, error) {
-	resp, err := http.Get(url)
+// It downloads the file from the url, creates the file at path, and writes the body of
+// the response to the file. Transient errors are retried.
+func (s *SimpleStorage) DownloadPhoto(ctx context.Context, url, path string) (*sources.File, error) {
+	var file *sources.File
+	err := s.withRetries(ctx, func() error {
+		var err error
+		file, err = s.download(ctx, url, path)
+		return err
+	})
 	if err != nil {
 		log.Println(err)
-		return "", err
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("%q is unavailable. code is %d", url, resp.StatusCode)
-		return "", err
+	return file, nil
+}
+
+// download saves the response body to path, the extension of path is replaced with the one of
+// the content type if it is known. The file is verified and renamed into place, see writeAtomic.
+func (s *SimpleStorage) download(ctx context.Context, url, path string) (*sources.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
-	name, _ := filename(url)
-	filepath := s.FilePath(dir, name)
-	// Create the file
-	out, err := os.Create(filepath)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(url, resp)
+	}
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	path = withExt(path, contentExt(resp, body))
+	return writeAtomic(url, path, body, resp.ContentLength, resp.Header)
+}
+
+// PlanPhoto returns where the photo would be saved in rootDir and its size if the server tells it by HEAD request,
+// nothing is written
+func (s *SimpleStorage) PlanPhoto(ctx context.Context, rootDir string, album sources.Album, photo sources.Photo) (*sources.PlannedFile, error) {
+	rootDir, err := s.DirPath(rootDir)
 	if err != nil {
-		log.Println(err)
-		return "", err
+		return nil, err
+	}
+	path, err := s.photoPath(rootDir, album, photo, true)
+	if err != nil {
+		return nil, err
 	}
+	return &sources.PlannedFile{
+		PhotoID:  photo.ID(),
+		AlbumDir: filepath.Dir(path),
+		Path:     path,
+		Size:     remoteSize(ctx, photo.Url()),
+	}, nil
+}
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+// remoteSize returns Content-Length of the url, it is -1 if unknown
+func remoteSize(ctx context.Context, url string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
 	if err != nil {
-		return "", err
+		return -1
 	}
-	out.Close()
-	return filepath, nil
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
 }
 
 // It's setting EXIF data for the downloaded file.
+// SetExif embeds the info into JPEG, PNG and WebP files, other formats are reported by sources.ErrFormatUnsupported
 func (s *SimpleStorage) SetExif(filepath string, photoExif sources.ExifInfo) error {
-	image, err := exif.Open(filepath)
+	format, err := detectFormat(filepath)
 	if err != nil {
-		log.Println("exif.Open", err)
 		return err
 	}
-	defer image.Close()
 	if photoExif == nil {
 		return errors.New("exif is empty")
 	}
-	err = image.SetDescription(photoExif.Description())
-	if err != nil {
-		return err
-	}
-	err = image.SetTime(photoExif.Created())
-	if err != nil {
-		return err
+	merge := func(existing []byte) ([]byte, error) {
+		return s.exifPayload(existing, photoExif)
 	}
-	gps := photoExif.GPS()
-	if gps == nil {
-		return errors.New("gps is empty")
+	switch format {
+	case formatPNG:
+		return setPNGExif(filepath, merge)
+	case formatWebP:
+		return setWebPExif(filepath, merge)
+	case formatUnknown:
+		return fmt.Errorf("SetExif: %w", sources.ErrFormatUnsupported)
 	}
-	err = image.SetGPS(gps[0], gps[1])
+	written, err := setJPEGExif(filepath, func(root *exif.IfdBuilder) (map[string]bool, error) {
+		return s.setTags(root, photoExif)
+	})
 	if err != nil {
+		log.Println("SetExif", err)
 		return err
 	}
+	return setJPEGIPTC(filepath, photoExif, written)
+}
 
+// SetTimes sets modification and access times of the file to t, so file managers sort photos by creation date
+func (s *SimpleStorage) SetTimes(filepath string, t time.Time) error {
+	if err := os.Chtimes(filepath, t, t); err != nil {
+		return fmt.Errorf("SetTimes: %w", err)
+	}
 	return nil
 }
 
 func New() sources.Storage {
-	return &SimpleStorage{}
+	return NewWithOptions()
 }
 
-type service struct{}
+// NewWithOptions creates a storage configured by opts
+func NewWithOptions(opts ...Option) sources.Storage {
+	s := &SimpleStorage{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type service struct {
+	opts []Option
+}
 
 func (s *service) Kind() sources.Kind {
 	return sources.KindStorage
@@ -145,9 +301,12 @@ func (s *service) Key() string {
 }
 
 func (s *service) Constructor() func() sources.Storage {
-	return New
+	return func() sources.Storage {
+		return NewWithOptions(s.opts...)
+	}
 }
 
-func NewService() sources.ServiceStorage {
-	return &service{}
+// NewService returns the local file system storage service, every storage it constructs is configured by opts
+func NewService(opts ...Option) sources.ServiceStorage {
+	return &service{opts: opts}
 }
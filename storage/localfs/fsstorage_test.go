@@ -1,6 +1,13 @@
 package localfs
 
 import (
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -25,7 +32,44 @@ func (e *ExifInfo) GPS() []float64 {
 	return e.gps
 }
 
-func TestSimpleStorage_dirPath(t *testing.T) {
+type photoItem struct {
+	id        string
+	url       string
+	albumID   string
+	albumName string
+}
+
+func (p *photoItem) ID() string {
+	return p.id
+}
+
+func (p *photoItem) Url() string {
+	return p.url
+}
+
+func (p *photoItem) AlbumID() string {
+	return p.albumID
+}
+
+func (p *photoItem) AlbumName() string {
+	return p.albumName
+}
+
+func (p *photoItem) ExifInfo() (sources.ExifInfo, error) {
+	return nil, nil
+}
+
+// writeJPEG creates a small jpeg image without metadata
+func writeJPEG(t *testing.T, path string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, 20, 30)), nil))
+}
+
+func TestSimpleStorage_DirPath(t *testing.T) {
 	type fields struct {
 		Dir string
 	}
@@ -64,7 +108,7 @@ func TestSimpleStorage_dirPath(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SimpleStorage{}
-			got, err := s.dirPath(tt.args.dir)
+			got, err := s.DirPath(tt.args.dir)
 			assert.Equal(t, tt.wantErr, err != nil)
 			if tt.want == "homeDir" {
 				assert.NotEmpty(t, got)
@@ -135,45 +179,64 @@ func TestSimpleStorage_FilePath(t *testing.T) {
 	}
 }
 
-func TestSimpleStorage_createAlbumDir(t *testing.T) {
-	type args struct {
-		albumName string
-		rootDir   string
-	}
+func TestSimpleStorage_PreparePhoto(t *testing.T) {
+	rootDir := t.TempDir()
+	photo := &photoItem{id: "1", url: "https://example.com/photo.jpg"}
+	// cases share rootDir, every case sees dirs of the previous ones
 	tests := []struct {
-		name    string
-		args    args
-		want    string
-		wantErr bool
+		name  string
+		album sources.Album
+		want  string
 	}{
 		{
-			name:    "no error",
-			args:    args{albumName: "album1", rootDir: "/tmp/photoD"},
-			want:    "/tmp/photoD/album1",
-			wantErr: false,
+			name:  "new album",
+			album: sources.Album{Source: "vk", ID: "1", Name: "album1"},
+			want:  filepath.Join(rootDir, "album1", "1.jpg"),
+		},
+		{
+			name:  "same name",
+			album: sources.Album{Source: "vk", ID: "2", Name: "album1"},
+			want:  filepath.Join(rootDir, "album1 (2)", "1.jpg"),
+		},
+		{
+			name:  "same name differs in case",
+			album: sources.Album{Source: "vk", ID: "3", Name: "Album1"},
+			want:  filepath.Join(rootDir, "Album1 (3)", "1.jpg"),
+		},
+		{
+			name:  "same album",
+			album: sources.Album{Source: "vk", ID: "2", Name: "album1"},
+			want:  filepath.Join(rootDir, "album1 (2)", "1.jpg"),
+		},
+		{
+			name:  "same id of another source",
+			album: sources.Album{Source: "instagram", ID: "2", Name: "album1"},
+			want:  filepath.Join(rootDir, "album1 (2) 2", "1.jpg"),
+		},
+		{
+			name:  "no name",
+			album: sources.Album{Source: "vk", ID: "4"},
+			want:  filepath.Join(rootDir, "4", "1.jpg"),
 		},
-		// {
-		// 	name:    "error",
-		// 	fields:  fields{Dir: ""},
-		// 	args:    args{albumName: "brrr"},
-		// 	want:    "",
-		// 	wantErr: true,
-		// },
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SimpleStorage{}
-			got, err := s.CreateAlbumDir(tt.args.rootDir, tt.args.albumName)
-			assert.Equal(t, tt.wantErr, err != nil)
+			got, err := s.PreparePhoto(rootDir, tt.album, photo)
+			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got)
+			assert.DirExists(t, filepath.Dir(got))
 		})
 	}
+
+	_, err := (&SimpleStorage{}).PreparePhoto(filepath.Join(rootDir, "nonExistent"), sources.Album{Source: "vk", ID: "1"}, photo)
+	assert.Error(t, err)
 }
 
 func TestSimpleStorage_DownloadPhoto(t *testing.T) {
 	type args struct {
 		url,
-		albumName string
+		path string
 	}
 	tests := []struct {
 		name string
@@ -190,7 +253,7 @@ func TestSimpleStorage_DownloadPhoto(t *testing.T) {
 		},
 		{
 			name: "empty exif",
-			args: args{url: "https://picsum.photos/200/300.jpg", albumName: "300"},
+			args: args{url: "https://picsum.photos/200/300.jpg", path: "/tmp/photoD/300.jpg"},
 		},
 		{
 			name: "404",
@@ -198,26 +261,26 @@ func TestSimpleStorage_DownloadPhoto(t *testing.T) {
 		},
 		{
 			name: "dir is empty",
-			args: args{url: "https://picsum.photos/200/300.jpg", albumName: "300"},
+			args: args{url: "https://picsum.photos/200/300.jpg", path: "/tmp/photoD/300.jpg"},
 		},
 		{
 			name: "exif",
 			args: args{
-				url:       "https://picsum.photos/200/300.jpg",
-				albumName: "300",
+				url:  "https://picsum.photos/200/300.jpg",
+				path: "/tmp/photoD/300.jpg",
 			},
 		},
 		{
 			name: "gps is nil",
 			args: args{url: "https://picsum.photos/200/300.jpg",
-				albumName: "300",
+				path: "/tmp/photoD/300.jpg",
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SimpleStorage{}
-			s.DownloadPhoto(tt.args.url, tt.args.albumName)
+			s.DownloadPhoto(context.Background(), tt.args.url, tt.args.path)
 		})
 	}
 }
@@ -235,7 +298,7 @@ func TestSimpleStorage_SetExif(t *testing.T) {
 		{
 			name:    "gps is nil",
 			args:    args{filepath: "/tmp/photoD/300.jpg", photoExif: &ExifInfo{}},
-			wantErr: true,
+			wantErr: false,
 		},
 		{
 			name:    "gps exists",
@@ -256,13 +319,27 @@ func TestSimpleStorage_SetExif(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SimpleStorage{}
-			s.DownloadPhoto("https://picsum.photos/200/300.jpg", "/tmp/photoD/")
+			writeJPEG(t, "/tmp/photoD/300.jpg")
 			err := s.SetExif(tt.args.filepath, tt.args.photoExif)
 			assert.Equal(t, tt.wantErr, err != nil)
 		})
 	}
 }
 
+func TestSimpleStorage_SetTimes(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "1.mp4")
+	assert.NoError(t, os.WriteFile(video, []byte("video"), 0640))
+	created := time.Date(2019, 5, 4, 12, 30, 0, 0, time.FixedZone("", 3*60*60))
+	s := &SimpleStorage{}
+
+	assert.NoError(t, s.SetTimes(video, created))
+	stat, err := os.Stat(video)
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(stat.ModTime()))
+	assert.Error(t, s.SetTimes(filepath.Join(dir, "2.mp4"), created))
+}
+
 func Test_filename(t *testing.T) {
 	type args struct {
 		path string
@@ -285,6 +362,12 @@ func Test_filename(t *testing.T) {
 			want:    "",
 			wantErr: true,
 		},
+		{
+			name:    "sanitized",
+			args:    args{path: "https://example.com/a/ph%3Foto.jpg?size=1"},
+			want:    "ph_oto.jpg",
+			wantErr: false,
+		},
 		{
 			name:    "empty",
 			args:    args{path: ":/sdfsdf/sdfsdf"},
@@ -376,3 +459,54 @@ func TestNewService(t *testing.T) {
 		})
 	}
 }
+
+func TestSimpleStorage_PlanPhoto(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/404.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "12345")
+	}))
+	defer server.Close()
+	rootDir := filepath.Join(t.TempDir(), "dump")
+	tests := []struct {
+		name  string
+		photo sources.Photo
+		want  *sources.PlannedFile
+	}{
+		{
+			name:  "size is known",
+			photo: &photoItem{id: "1", url: server.URL + "/photo.jpg", albumName: "album"},
+			want: &sources.PlannedFile{
+				PhotoID:  "1",
+				AlbumDir: filepath.Join(rootDir, "album"),
+				Path:     filepath.Join(rootDir, "album", "1.jpg"),
+				Size:     12345,
+			},
+		},
+		{
+			name:  "size is unknown",
+			photo: &photoItem{id: "2", url: server.URL + "/404.jpg", albumName: "album"},
+			want: &sources.PlannedFile{
+				PhotoID:  "2",
+				AlbumDir: filepath.Join(rootDir, "album"),
+				Path:     filepath.Join(rootDir, "album", "2.jpg"),
+				Size:     -1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SimpleStorage{}
+			album := sources.Album{Source: "vk", ID: "1", Name: tt.photo.AlbumName()}
+			got, err := s.PlanPhoto(context.Background(), rootDir, album, tt.photo)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.False(t, s.Saved(rootDir, "vk", tt.photo.ID()))
+			assert.NoDirExists(t, rootDir)
+		})
+	}
+	_, err := (&SimpleStorage{}).PlanPhoto(context.Background(), "", sources.Album{}, &photoItem{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,262 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"unicode/utf8"
+
+	"github.com/Gasoid/photoDumper/sources"
+	exif "github.com/dsoprea/go-exif/v2"
+	jpegstructure "github.com/dsoprea/go-jpeg-image-structure"
+)
+
+// IPTC datasets, see IPTC-IIM 4.2
+const (
+	iptcCodedCharset  = 90
+	iptcRecordVersion = 0
+	iptcObjectName    = 5
+	iptcKeywords      = 25
+	iptcDateCreated   = 55
+	iptcTimeCreated   = 60
+	iptcByline        = 80
+	iptcCaption       = 120
+)
+
+// iptcTags are datasets of the application record which are written for tags
+var iptcTags = map[string][]byte{
+	TagTitle:       {iptcObjectName},
+	TagKeywords:    {iptcKeywords},
+	TagCreated:     {iptcDateCreated, iptcTimeCreated},
+	TagAuthor:      {iptcByline},
+	TagDescription: {iptcCaption},
+}
+
+// photoshopHeader starts an APP13 segment of Photoshop resources, iptcResource is an ID of the IPTC resource
+const (
+	photoshopHeader = "Photoshop 3.0\x00"
+	iptcResource    = 0x0404
+)
+
+type iptcDataset struct {
+	record, tag byte
+	value       []byte
+}
+
+// photoshopResource is a resource of an APP13 segment, name is a padded pascal string
+type photoshopResource struct {
+	id   uint16
+	name []byte
+	data []byte
+}
+
+// truncate cuts s to n bytes keeping runes whole
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// encodeIPTC returns IPTC datasets of the written tags of the info followed by datasets of existing which are kept,
+// strings are UTF-8 and cut to lengths of the standard
+func encodeIPTC(info sources.ExifInfo, written map[string]bool, existing []iptcDataset) []byte {
+	var b bytes.Buffer
+	dataset := func(record, tag byte, value []byte) {
+		b.Write([]byte{0x1c, record, tag})
+		binary.Write(&b, binary.BigEndian, uint16(len(value)))
+		b.Write(value)
+	}
+	dataset(1, iptcCodedCharset, []byte("\x1b%G"))
+	dataset(2, iptcRecordVersion, []byte{0, 4})
+	d := details(info)
+	if written[TagTitle] {
+		dataset(2, iptcObjectName, []byte(truncate(d.Title(), 64)))
+	}
+	if written[TagKeywords] {
+		for _, keyword := range d.Keywords() {
+			dataset(2, iptcKeywords, []byte(truncate(keyword, 64)))
+		}
+	}
+	if written[TagCreated] {
+		created := info.Created()
+		dataset(2, iptcDateCreated, []byte(created.Format("20060102")))
+		dataset(2, iptcTimeCreated, []byte(created.Format("150405-0700")))
+	}
+	if written[TagAuthor] {
+		dataset(2, iptcByline, []byte(truncate(d.Author(), 32)))
+	}
+	if written[TagDescription] {
+		dataset(2, iptcCaption, []byte(truncate(info.Description(), 2000)))
+	}
+
+	replaced := map[[2]byte]bool{{1, iptcCodedCharset}: true, {2, iptcRecordVersion}: true}
+	for tag, tags := range iptcTags {
+		if written[tag] {
+			for _, t := range tags {
+				replaced[[2]byte{2, t}] = true
+			}
+		}
+	}
+	for _, ds := range existing {
+		if !replaced[[2]byte{ds.record, ds.tag}] {
+			dataset(ds.record, ds.tag, ds.value)
+		}
+	}
+	return b.Bytes()
+}
+
+// parseIPTC returns datasets of data, it stops at a dataset of an extended size
+func parseIPTC(data []byte) []iptcDataset {
+	datasets := []iptcDataset{}
+	for len(data) >= 5 && data[0] == 0x1c {
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if size&0x8000 != 0 || 5+size > len(data) {
+			break
+		}
+		datasets = append(datasets, iptcDataset{record: data[1], tag: data[2], value: data[5 : 5+size]})
+		data = data[5+size:]
+	}
+	return datasets
+}
+
+// parsePhotoshop returns resources of an APP13 segment without the header, it stops at a corrupted resource
+func parsePhotoshop(data []byte) []photoshopResource {
+	resources := []photoshopResource{}
+	for len(data) >= 12 && string(data[:4]) == "8BIM" {
+		nameSize := int(data[6]) + 1
+		nameSize += nameSize % 2
+		if 6+nameSize+4 > len(data) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[6+nameSize:]))
+		start := 6 + nameSize + 4
+		if size > len(data)-start {
+			break
+		}
+		resources = append(resources, photoshopResource{id: binary.BigEndian.Uint16(data[4:6]), name: data[6 : 6+nameSize], data: data[start : start+size]})
+		data = data[min(len(data), start+size+size%2):]
+	}
+	return resources
+}
+
+// setJPEGExif sets tags of the APP1 segment of the jpeg by set, the file is replaced atomically
+// and kept as is if set fails. It returns tags written by set.
+func setJPEGExif(path string, set func(root *exif.IfdBuilder) (map[string]bool, error)) (map[string]bool, error) {
+	parsed, err := jpegstructure.NewJpegMediaParser().ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sl := parsed.(*jpegstructure.SegmentList)
+	root, err := sl.ConstructExifBuilder()
+	if err != nil {
+		// the file has no exif
+		if root, err = newExifBuilder(nil); err != nil {
+			return nil, err
+		}
+	}
+	written, err := set(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := sl.SetExif(root); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := sl.Write(&b); err != nil {
+		return nil, err
+	}
+	return written, writeFileAtomic(path, b.Bytes())
+}
+
+// setJPEGIPTC writes IPTC of the written tags to an APP13 segment of the jpeg, other datasets and resources
+// of an existing segment are kept
+func setJPEGIPTC(path string, info sources.ExifInfo, written map[string]bool) error {
+	if len(written) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return errors.New("jpeg has no SOI marker")
+	}
+
+	// segments are kept as is except the APP13 of Photoshop resources
+	var segments [][]byte
+	var resources []photoshopResource
+	rest := data[2:]
+	for {
+		if len(rest) < 4 || rest[0] != 0xff {
+			return errors.New("jpeg is truncated")
+		}
+		if rest[1] == 0xda {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(rest[2:4])) + 2
+		if size > len(rest) {
+			return errors.New("jpeg segment is truncated")
+		}
+		if rest[1] == 0xed && bytes.HasPrefix(rest[4:size], []byte(photoshopHeader)) {
+			resources = append(resources, parsePhotoshop(rest[4+len(photoshopHeader):size])...)
+		} else {
+			segments = append(segments, rest[:size])
+		}
+		rest = rest[size:]
+	}
+
+	var existing []iptcDataset
+	kept := resources[:0]
+	for _, r := range resources {
+		if r.id == iptcResource {
+			existing = append(existing, parseIPTC(r.data)...)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	resources = append(kept, photoshopResource{id: iptcResource, name: []byte{0, 0}, data: encodeIPTC(info, written, existing)})
+	var segment bytes.Buffer
+	segment.WriteString(photoshopHeader)
+	for _, r := range resources {
+		segment.WriteString("8BIM")
+		binary.Write(&segment, binary.BigEndian, r.id)
+		segment.Write(r.name)
+		binary.Write(&segment, binary.BigEndian, uint32(len(r.data)))
+		segment.Write(r.data)
+		if len(r.data)%2 == 1 {
+			segment.WriteByte(0)
+		}
+	}
+	if segment.Len()+2 > 0xffff {
+		return errors.New("iptc doesn't fit into a jpeg segment")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	inserted := false
+	for _, s := range segments {
+		// APP13 follows APP0, APP1 of exif and APP2
+		if !inserted && (s[1] < 0xe0 || s[1] > 0xe2) {
+			writeAPP13(&out, segment.Bytes())
+			inserted = true
+		}
+		out.Write(s)
+	}
+	if !inserted {
+		writeAPP13(&out, segment.Bytes())
+	}
+	out.Write(rest)
+	return writeFileAtomic(path, out.Bytes())
+}
+
+func writeAPP13(out *bytes.Buffer, payload []byte) {
+	out.Write([]byte{0xff, 0xed})
+	binary.Write(out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+}
@@ -0,0 +1,193 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	exif "github.com/dsoprea/go-exif/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// detailedExif is ExifInfo which implements sources.ExifDetails
+type detailedExif struct {
+	ExifInfo
+	title    string
+	keywords []string
+	author   string
+	uniqueID string
+}
+
+func (e *detailedExif) Title() string {
+	return e.title
+}
+
+func (e *detailedExif) Keywords() []string {
+	return e.keywords
+}
+
+func (e *detailedExif) Author() string {
+	return e.author
+}
+
+func (e *detailedExif) UniqueID() string {
+	return e.uniqueID
+}
+
+// app13Segments returns payloads of APP13 segments of the jpeg
+func app13Segments(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	segments := [][]byte{}
+	for rest := data[2:]; len(rest) >= 4 && rest[1] != 0xda; {
+		size := int(binary.BigEndian.Uint16(rest[2:])) + 2
+		if rest[1] == 0xed {
+			segments = append(segments, rest[4:size])
+		}
+		rest = rest[size:]
+	}
+	return segments
+}
+
+// iptcValues returns values of IPTC datasets of the APP13 payload by dataset numbers
+func iptcValues(t *testing.T, segment []byte) map[byte][]string {
+	t.Helper()
+	values := map[byte][]string{}
+	for _, r := range parsePhotoshop(segment[len(photoshopHeader):]) {
+		if r.id != iptcResource {
+			continue
+		}
+		for _, ds := range parseIPTC(r.data) {
+			values[ds.tag] = append(values[ds.tag], string(ds.value))
+		}
+	}
+	return values
+}
+
+func TestSimpleStorage_SetExifDetails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.jpg")
+	writeJPEG(t, path)
+	created := time.Date(2021, 7, 9, 10, 11, 12, 0, time.FixedZone("MSK", 3*60*60))
+	info := &detailedExif{
+		ExifInfo: ExifInfo{description: "Kazan", created: created},
+		title:    "Кремль",
+		keywords: []string{"Summer", "kazan"},
+		author:   "id1",
+		uniqueID: "1_2",
+	}
+	s := &SimpleStorage{}
+	assert.NoError(t, s.SetExif(path, info))
+	// the second call keeps the date and replaces other tags
+	info.created = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	info.description = "Kazan, Russia"
+	assert.NoError(t, s.SetExif(path, info))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	raw, err := exif.SearchAndExtractExif(data)
+	assert.NoError(t, err)
+	tags := exifTags(t, raw)
+	assert.Equal(t, "Kazan, Russia", tags["IFD/ImageDescription"])
+	assert.Equal(t, "id1", tags["IFD/Artist"])
+	assert.Equal(t, ucs2("Кремль"), tags["IFD/XPTitle"])
+	assert.Equal(t, ucs2("Summer;kazan"), tags["IFD/XPKeywords"])
+	assert.Equal(t, "1_2", tags["IFD/Exif/ImageUniqueID"])
+	assert.Equal(t, "2021:07:09 10:11:12", tags["IFD/Exif/DateTimeOriginal"])
+	assert.Equal(t, "+03:00", tags[fmt.Sprintf("IFD/Exif/0x%04x", tagOffsetTime)])
+
+	segments := app13Segments(t, data)
+	assert.Len(t, segments, 1)
+	assert.Equal(t, map[byte][]string{
+		iptcCodedCharset:  {"\x1b%G"},
+		iptcRecordVersion: {"\x00\x04"},
+		iptcObjectName:    {"Кремль"},
+		iptcKeywords:      {"Summer", "kazan"},
+		iptcByline:        {"id1"},
+		iptcCaption:       {"Kazan, Russia"},
+		// the date is kept as the date of exif is kept
+		iptcDateCreated: {"20210709"},
+		iptcTimeCreated: {"101112+0300"},
+	}, iptcValues(t, segments[0]))
+}
+
+func TestSimpleStorage_SetExifKeepsResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.jpg")
+	writeJPEG(t, path)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	// an APP13 with a resolution resource and IPTC of a copyright and a caption
+	iptc := []byte("\x1c\x02\x74\x00\x04Me\x21\x21\x1c\x02\x78\x00\x03old")
+	payload := append([]byte(photoshopHeader+"8BIM\x03\xed\x00\x00\x00\x00\x00\x02ab8BIM\x04\x04\x00\x00\x00\x00\x00"), byte(len(iptc)))
+	payload = append(payload, iptc...)
+	payload = append(payload, 0)
+	segment := append([]byte{0xff, 0xed, 0, byte(len(payload) + 2)}, payload...)
+	assert.NoError(t, os.WriteFile(path, append(append([]byte{0xff, 0xd8}, segment...), data[2:]...), 0640))
+
+	assert.NoError(t, (&SimpleStorage{}).SetExif(path, &ExifInfo{description: "new"}))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	segments := app13Segments(t, data)
+	assert.Len(t, segments, 1)
+	resources := parsePhotoshop(segments[0][len(photoshopHeader):])
+	assert.Len(t, resources, 2)
+	assert.Equal(t, photoshopResource{id: 0x03ed, name: []byte{0, 0}, data: []byte("ab")}, resources[0])
+	assert.Equal(t, map[byte][]string{
+		iptcCodedCharset:  {"\x1b%G"},
+		iptcRecordVersion: {"\x00\x04"},
+		iptcCaption:       {"new"},
+		116:               {"Me!!"},
+	}, iptcValues(t, segments[0]))
+}
+
+func Test_setJPEGExif(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "1.jpg")
+	writeJPEG(t, path)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// the file is kept as is if a tag fails
+	_, err = setJPEGExif(path, func(root *exif.IfdBuilder) (map[string]bool, error) {
+		return nil, fmt.Errorf("broken tag")
+	})
+	assert.Error(t, err)
+	got, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	assert.NoError(t, (&SimpleStorage{}).SetExif(path, &ExifInfo{description: "new"}))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func Test_encodeIPTC(t *testing.T) {
+	created := time.Date(2021, 7, 9, 10, 11, 12, 0, time.FixedZone("MSK", 3*60*60))
+	info := &detailedExif{
+		ExifInfo: ExifInfo{description: "Kazan", created: created},
+		title:    "Кремль",
+		keywords: []string{"Summer", string(bytes.Repeat([]byte("я"), 40))},
+		author:   "id1",
+	}
+	written := map[string]bool{TagTitle: true, TagKeywords: true, TagCreated: true, TagAuthor: true}
+	existing := []iptcDataset{{record: 2, tag: iptcCaption, value: []byte("old")}, {record: 2, tag: iptcByline, value: []byte("old")}}
+	datasets := map[byte][]string{}
+	for _, ds := range parseIPTC(encodeIPTC(info, written, existing)) {
+		datasets[ds.tag] = append(datasets[ds.tag], string(ds.value))
+	}
+	assert.Equal(t, map[byte][]string{
+		iptcCodedCharset:  {"\x1b%G"},
+		iptcRecordVersion: {"\x00\x04"},
+		iptcObjectName:    {"Кремль"},
+		// keywords are cut to 64 bytes keeping runes whole
+		iptcKeywords:    {"Summer", string(bytes.Repeat([]byte("я"), 32))},
+		iptcDateCreated: {"20210709"},
+		iptcTimeCreated: {"101112+0300"},
+		iptcByline:      {"id1"},
+		// the description is not written, the caption is kept
+		iptcCaption: {"old"},
+	}, datasets)
+}
@@ -0,0 +1,158 @@
+package localfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// DefaultLayout saves photos to dirs of their albums and names them by their IDs,
+// the extension is replaced with the one of the downloaded content
+const DefaultLayout = "{album}/{id}.{ext}"
+
+// unknownDate replaces dates of photos without a creation time
+const unknownDate = "unknown"
+
+// photoVars are values of placeholders of a layout
+type photoVars struct {
+	album    sources.Album
+	albumDir string
+	photo    sources.Photo
+	filename string
+	created  time.Time
+}
+
+// placeholders of a layout and their values
+var placeholders = map[string]func(v *photoVars) string{
+	"source":     func(v *photoVars) string { return v.album.Source },
+	"album":      func(v *photoVars) string { return v.albumDir },
+	"album_id":   func(v *photoVars) string { return v.album.ID },
+	"id":         func(v *photoVars) string { return v.photo.ID() },
+	"filename":   func(v *photoVars) string { return v.filename },
+	"name":       func(v *photoVars) string { return strings.TrimSuffix(v.filename, filepath.Ext(v.filename)) },
+	"ext":        func(v *photoVars) string { return strings.TrimPrefix(filepath.Ext(v.filename), ".") },
+	"yyyy":       func(v *photoVars) string { return v.date("2006") },
+	"mm":         func(v *photoVars) string { return v.date("01") },
+	"dd":         func(v *photoVars) string { return v.date("02") },
+	"yyyy-mm":    func(v *photoVars) string { return v.date("2006-01") },
+	"yyyy-mm-dd": func(v *photoVars) string { return v.date("2006-01-02") },
+}
+
+func (v *photoVars) date(layout string) string {
+	if v.created.IsZero() {
+		return unknownDate
+	}
+	return v.created.Format(layout)
+}
+
+// segment is either a literal text or a placeholder of a layout
+type segment struct {
+	text        string
+	placeholder bool
+}
+
+// Layout describes where photos are saved in a root dir, it is a slash separated path template with placeholders:
+// {source}, {album}, {album_id}, {id}, {filename}, {name}, {ext}, {yyyy}, {mm}, {dd}, {yyyy-mm} and {yyyy-mm-dd}.
+// Dates are creation dates of photos. E.g. "{source}/{album}/{yyyy}/{mm}/{filename}".
+type Layout struct {
+	template   string
+	components [][]segment
+}
+
+// NewLayout parses the template, it has to contain {filename}, {name} or {id} in the last component,
+// so files don't overwrite each other
+func NewLayout(template string) (*Layout, error) {
+	l := &Layout{template: template}
+	parts := strings.Split(template, "/")
+	for i, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("layout %q: empty path component", template)
+		}
+		segments, err := parseComponent(part)
+		if err != nil {
+			return nil, fmt.Errorf("layout %q: %w", template, err)
+		}
+		if i == len(parts)-1 && !hasPlaceholder(segments, "filename", "name", "id") {
+			return nil, fmt.Errorf("layout %q: file name has to contain {filename}, {name} or {id}", template)
+		}
+		l.components = append(l.components, segments)
+	}
+	return l, nil
+}
+
+func parseComponent(part string) ([]segment, error) {
+	var segments []segment
+	for part != "" {
+		start := strings.IndexAny(part, "{}")
+		if start < 0 {
+			segments = append(segments, segment{text: part})
+			break
+		}
+		if part[start] == '}' {
+			return nil, fmt.Errorf("unexpected }")
+		}
+		if start > 0 {
+			segments = append(segments, segment{text: part[:start]})
+		}
+		end := strings.IndexByte(part[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed {")
+		}
+		name := part[start+1 : start+end]
+		if _, ok := placeholders[name]; !ok {
+			return nil, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+		segments = append(segments, segment{text: name, placeholder: true})
+		part = part[start+end+1:]
+	}
+	return segments, nil
+}
+
+func hasPlaceholder(segments []segment, names ...string) bool {
+	for _, s := range segments {
+		for _, name := range names {
+			if s.placeholder && s.text == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the template of the layout
+func (l *Layout) String() string {
+	return l.template
+}
+
+// path returns a path of the photo relative to a root dir, every component is sanitized. Components of the album
+// and the file are shortened if the path is longer than limit UTF-16 units, see fitPath.
+func (l *Layout) path(v *photoVars, limit int) string {
+	components := make([]string, 0, len(l.components))
+	shortenable := make([]bool, 0, len(l.components))
+	for i, segments := range l.components {
+		shortenable = append(shortenable, i == len(l.components)-1 || hasPlaceholder(segments, "album"))
+		var b strings.Builder
+		for _, s := range segments {
+			if s.placeholder {
+				b.WriteString(placeholders[s.text](v))
+			} else {
+				b.WriteString(s.text)
+			}
+		}
+		components = append(components, sanitizeName(b.String()))
+	}
+	fitPath(components, shortenable, limit)
+	return filepath.Join(components...)
+}
+
+var defaultLayout, _ = NewLayout(DefaultLayout)
+
+// WithLayout sets a layout of saved photos, DefaultLayout is used by default
+func WithLayout(layout *Layout) Option {
+	return func(s *SimpleStorage) {
+		s.layout = layout
+	}
+}
@@ -0,0 +1,132 @@
+package localfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+type datedPhoto struct {
+	photoItem
+	created time.Time
+}
+
+func (p *datedPhoto) ExifInfo() (sources.ExifInfo, error) {
+	return &ExifInfo{created: p.created}, nil
+}
+
+func TestNewLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{name: "default", template: DefaultLayout},
+		{name: "chronological", template: "{yyyy}/{yyyy-mm-dd}_{album}_{id}.{ext}"},
+		{name: "nested", template: "{source}/{album}/{yyyy}/{mm}/{filename}"},
+		{name: "literal", template: "photos/{id}.jpg"},
+		{name: "no file name", template: "{album}/{yyyy}", wantErr: true},
+		{name: "file name in dir", template: "{filename}/{album}", wantErr: true},
+		{name: "unknown placeholder", template: "{albums}/{filename}", wantErr: true},
+		{name: "unclosed", template: "{album/{filename}", wantErr: true},
+		{name: "unexpected", template: "album}/{filename}", wantErr: true},
+		{name: "empty component", template: "{album}//{filename}", wantErr: true},
+		{name: "absolute", template: "/{filename}", wantErr: true},
+		{name: "empty", template: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := NewLayout(tt.template)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.template, layout.String())
+			}
+		})
+	}
+}
+
+func TestSimpleStorage_Layout(t *testing.T) {
+	created := time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC)
+	photo := &datedPhoto{photoItem: photoItem{id: "12_34", url: "https://example.com/a/photo.jpg"}, created: created}
+	album := sources.Album{Source: "vk", ID: "5", Name: "Sea/Sun"}
+	tests := []struct {
+		name     string
+		template string
+		photo    sources.Photo
+		want     string
+	}{
+		{name: "default", template: DefaultLayout, photo: photo, want: "Sea_Sun/12_34.jpg"},
+		{name: "nested", template: "{source}/{album}/{yyyy}/{mm}/{filename}", photo: photo, want: "vk/Sea_Sun/2021/07/photo.jpg"},
+		{name: "chronological", template: "{yyyy}/{yyyy-mm-dd}_{album}_{id}.{ext}", photo: photo, want: "2021/2021-07-09_Sea_Sun_12_34.jpg"},
+		{name: "name", template: "{yyyy-mm}/{dd}/{name}_{album_id}.{ext}", photo: photo, want: "2021-07/09/photo_5.jpg"},
+		{name: "unknown date", template: "{yyyy}/{filename}", photo: &photo.photoItem, want: "unknown/photo.jpg"},
+		{name: "no file name in url", template: "{album}/{filename}", photo: &photoItem{id: "7", url: "https://example.com/"}, want: "Sea_Sun/7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			layout, err := NewLayout(tt.template)
+			assert.NoError(t, err)
+			s := NewWithOptions(WithLayout(layout))
+
+			planned, err := s.PlanPhoto(context.Background(), rootDir, album, tt.photo)
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(rootDir, tt.want), planned.Path)
+			assert.Equal(t, filepath.Dir(planned.Path), planned.AlbumDir)
+
+			path, err := s.PreparePhoto(rootDir, album, tt.photo)
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(rootDir, tt.want), path)
+			assert.DirExists(t, filepath.Dir(path))
+		})
+	}
+}
+
+func TestLayout_pathLimit(t *testing.T) {
+	created := time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC)
+	long := strings.Repeat("a", 100)
+	tests := []struct {
+		name     string
+		template string
+		album    string
+		filename string
+		limit    int
+		want     string
+	}{
+		{name: "fits", template: "{source}/{album}/{yyyy}/{filename}", album: "Sea", filename: "photo.jpg", limit: 100, want: "vk/Sea/2021/photo.jpg"},
+		{name: "album keeps suffix", template: "{source}/{album}/{yyyy}/{filename}", album: long + " (5)", filename: "photo.jpg", limit: 60, want: "vk/" + strings.Repeat("a", 38) + " (5)/2021/photo.jpg"},
+		{name: "file first", template: "{source}/{album}/{yyyy}/{filename}", album: long, filename: strings.Repeat("b", 100) + ".jpg", limit: 80, want: "vk/" + strings.Repeat("a", 39) + "/2021/" + strings.Repeat("b", 28) + ".jpg"},
+		{name: "utf-16 units", template: "{album}/{filename}", album: strings.Repeat("😀", 40), filename: "1.jpg", limit: 50, want: strings.Repeat("😀", 22) + "/1.jpg"},
+		{name: "album in file name", template: "{yyyy}/{album}_{filename}", album: long, filename: "1.jpg", limit: 50, want: "2021/" + strings.Repeat("a", 41) + ".jpg"},
+		{name: "long root", template: "{source}/{album}/{filename}", album: long, filename: strings.Repeat("b", 100) + ".jpg", limit: 0, want: "vk/" + strings.Repeat("a", minNameLen) + "/" + strings.Repeat("b", minNameLen-4) + ".jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := NewLayout(tt.template)
+			assert.NoError(t, err)
+			vars := &photoVars{album: sources.Album{Source: "vk", ID: "5"}, albumDir: tt.album, photo: &photoItem{id: "1"}, filename: tt.filename, created: created}
+			assert.Equal(t, filepath.FromSlash(tt.want), layout.path(vars, tt.limit))
+		})
+	}
+}
+
+func TestSimpleStorage_PreparePhotoLongPath(t *testing.T) {
+	rootDir := filepath.Join(t.TempDir(), strings.Repeat("r", 100))
+	assert.NoError(t, os.MkdirAll(rootDir, 0750))
+	layout, err := NewLayout("{source}/{album}/{yyyy}/{filename}")
+	assert.NoError(t, err)
+	s := NewWithOptions(WithLayout(layout))
+	album := sources.Album{Source: "vk", ID: "5", Name: strings.Repeat("Море ", 40)}
+
+	path, err := s.PreparePhoto(rootDir, album, &photoItem{id: "1", url: "https://example.com/" + strings.Repeat("b", 150) + ".jpg"})
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, units(path), maxPathLen-pathReserve)
+	assert.Equal(t, ".jpg", filepath.Ext(path))
+	assert.DirExists(t, filepath.Dir(path))
+}
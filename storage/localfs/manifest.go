@@ -0,0 +1,261 @@
+package localfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// manifestName is a name of the manifest file in the root dir, every line is a json encoded sources.ManifestEntry
+const manifestName = "manifest.jsonl"
+
+var (
+	manifests   = map[string]*manifest{}
+	manifestsMu sync.Mutex
+)
+
+// manifest keeps entries of photos saved to a root dir, it is shared by all storages writing to the dir
+type manifest struct {
+	rootDir string
+	mu      sync.RWMutex
+	entries map[string]sources.ManifestEntry
+	// owners maps stems of paths to keys of photos saved or being saved there, see pathKey
+	owners map[string]string
+	// planned keeps paths claimed by dry runs
+	planned map[string]string
+	// hashes maps sha256 of downloaded content to paths of recorded files which are not duplicates
+	hashes map[string]string
+	// saving maps hashes to files which are going to be originals of their content once they are recorded
+	saving map[string]*savingFile
+}
+
+// savingFile is a new original which metadata is being written, done is closed when it is recorded
+type savingFile struct {
+	path string
+	done chan struct{}
+}
+
+func manifestKey(source, photoID string) string {
+	return source + "/" + photoID
+}
+
+// pathKey returns a key of the path relative to the root dir. Files which differ in case or extension
+// of a photo share the key, they collide on some file systems or after the extension is detected.
+func pathKey(rel string) string {
+	return strings.ToLower(stem(filepath.ToSlash(rel)))
+}
+
+// loadManifest reads the manifest of rootDir once, subsequent calls return the cached one.
+// A missing manifest file is not created, so it is safe for dry runs.
+func loadManifest(rootDir string) (*manifest, error) {
+	manifestsMu.Lock()
+	defer manifestsMu.Unlock()
+	if m, ok := manifests[rootDir]; ok {
+		return m, nil
+	}
+	m := &manifest{
+		rootDir: rootDir,
+		entries: map[string]sources.ManifestEntry{},
+		owners:  map[string]string{},
+		planned: map[string]string{},
+		hashes:  map[string]string{},
+		saving:  map[string]*savingFile{},
+	}
+	f, err := os.Open(filepath.Join(rootDir, manifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		manifests[rootDir] = m
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadManifest: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry sources.ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// a broken line is left by an interrupted write, the photo will be downloaded again
+			continue
+		}
+		m.index(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("loadManifest: %w", err)
+	}
+	manifests[rootDir] = m
+	return m, nil
+}
+
+// create creates an empty manifest file if it doesn't exist
+func (m *manifest) create() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(m.rootDir, manifestName), os.O_WRONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return f.Close()
+}
+
+// saved reports whether the photo is in the manifest and its file still exists
+func (m *manifest) saved(source, photoID string) bool {
+	m.mu.RLock()
+	entry, ok := m.entries[manifestKey(source, photoID)]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(m.rootDir, entry.Path))
+	return err == nil
+}
+
+// add appends the entry to the manifest file, the path of the entry is stored relative to the root dir
+func (m *manifest) add(entry sources.ManifestEntry) error {
+	if rel, err := filepath.Rel(m.rootDir, entry.Path); err == nil {
+		entry.Path = rel
+	}
+	if rel, err := filepath.Rel(m.rootDir, entry.DuplicateOf); err == nil && entry.DuplicateOf != "" {
+		entry.DuplicateOf = rel
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err = m.append(line)
+	if err == nil {
+		m.index(entry)
+	}
+	// duplicates waiting for the file go on, the file is the original of its content if it is recorded
+	if saving, ok := m.saving[entry.Hash]; ok && saving.path == entry.Path {
+		if err == nil {
+			m.hashes[entry.Hash] = entry.Path
+		}
+		delete(m.saving, entry.Hash)
+		close(saving.done)
+	}
+	return err
+}
+
+// append must be called with m.mu held, it appends the line to the manifest file
+func (m *manifest) append(line []byte) error {
+	f, err := os.OpenFile(filepath.Join(m.rootDir, manifestName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return nil
+}
+
+// index adds the entry to the indexes of the manifest, the path of the entry is relative to the root dir
+func (m *manifest) index(entry sources.ManifestEntry) {
+	key := manifestKey(entry.Source, entry.PhotoID)
+	m.entries[key] = entry
+	// a skipped duplicate points to the file of another photo
+	if entry.DuplicateOf != entry.Path {
+		m.owners[pathKey(entry.Path)] = key
+	}
+	if _, ok := m.hashes[entry.Hash]; !ok && entry.Hash != "" && entry.DuplicateOf == "" {
+		m.hashes[entry.Hash] = entry.Path
+	}
+}
+
+// original returns a path of an existing recorded file of the content with the hash. If there is no such file,
+// the file at path is going to be the original once it is recorded, so its metadata is written before
+// duplicates link to it. A duplicate of a file which is not recorded yet waits for it.
+func (m *manifest) original(hash, path string) (string, bool) {
+	rel, err := filepath.Rel(m.rootDir, path)
+	if err != nil {
+		return "", false
+	}
+	for {
+		m.mu.Lock()
+		if known, ok := m.hashes[hash]; ok {
+			original := filepath.Join(m.rootDir, known)
+			if original != path && exists(original) {
+				m.mu.Unlock()
+				return original, true
+			}
+		}
+		saving, ok := m.saving[hash]
+		if !ok {
+			m.saving[hash] = &savingFile{path: rel, done: make(chan struct{})}
+		}
+		m.mu.Unlock()
+		if !ok || saving.path == rel {
+			return "", false
+		}
+		<-saving.done
+	}
+}
+
+// claim returns a path for the photo which is not used by another photo or an unknown file,
+// "_2", "_3" and so on are added to the name if path is taken. The path is reserved for the photo
+// unless it is a dry run.
+func (m *manifest) claim(path, source, photoID string, dryRun bool) string {
+	key := manifestKey(source, photoID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name, ext := stem(path), path[len(stem(path)):]
+	// a saved photo keeps its path, suffixes are given in order of downloads
+	if entry, ok := m.entries[key]; ok {
+		if rel, err := filepath.Rel(m.rootDir, name); err == nil && isVariant(pathKey(entry.Path), strings.ToLower(filepath.ToSlash(rel))) {
+			return filepath.Join(m.rootDir, entry.Path)
+		}
+	}
+	candidate := path
+	for i := 2; ; i++ {
+		rel, err := filepath.Rel(m.rootDir, candidate)
+		if err != nil {
+			return candidate
+		}
+		owner, ok := m.owners[pathKey(rel)]
+		if !ok && dryRun {
+			owner, ok = m.planned[pathKey(rel)]
+		}
+		if owner == key {
+			return candidate
+		}
+		if !ok && !exists(candidate) {
+			if dryRun {
+				m.planned[pathKey(rel)] = key
+			} else {
+				m.owners[pathKey(rel)] = key
+			}
+			return candidate
+		}
+		candidate = name + "_" + strconv.Itoa(i) + ext
+	}
+}
+
+// isVariant reports whether key is name or name with a suffix given by claim
+func isVariant(key, name string) bool {
+	if key == name {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(key, name+"_")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,51 @@
+package localfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleStorage_Manifest(t *testing.T) {
+	rootDir := t.TempDir()
+	s := &SimpleStorage{}
+	_, err := s.Prepare(rootDir)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(rootDir, manifestName))
+
+	photoPath := filepath.Join(rootDir, "album", "1.jpg")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(photoPath), 0750))
+	assert.NoError(t, os.WriteFile(photoPath, []byte("photo"), 0640))
+
+	assert.False(t, s.Saved(rootDir, "vk", "1"))
+	err = s.Record(rootDir, sources.ManifestEntry{Source: "vk", PhotoID: "1", Path: photoPath, Size: 5})
+	assert.NoError(t, err)
+	assert.True(t, s.Saved(rootDir, "vk", "1"))
+	assert.False(t, s.Saved(rootDir, "instagram", "1"))
+
+	// a broken line must not prevent loading the manifest
+	f, err := os.OpenFile(filepath.Join(rootDir, manifestName), os.O_WRONLY|os.O_APPEND, 0640)
+	assert.NoError(t, err)
+	f.WriteString("{broken\n")
+	f.Close()
+
+	manifestsMu.Lock()
+	delete(manifests, rootDir)
+	manifestsMu.Unlock()
+	m, err := loadManifest(rootDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("album", "1.jpg"), m.entries[manifestKey("vk", "1")].Path)
+	assert.True(t, s.Saved(rootDir, "vk", "1"))
+
+	assert.NoError(t, os.Remove(photoPath))
+	assert.False(t, s.Saved(rootDir, "vk", "1"))
+}
+
+func TestSimpleStorage_SavedNoDir(t *testing.T) {
+	s := &SimpleStorage{}
+	assert.False(t, s.Saved(filepath.Join(t.TempDir(), "nonExistent"), "vk", "1"))
+	assert.Error(t, s.Record(filepath.Join(t.TempDir(), "nonExistent"), sources.ManifestEntry{}))
+}
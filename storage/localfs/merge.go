@@ -0,0 +1,94 @@
+package localfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergePolicy tells whether SetExif writes a tag which the file already has
+type MergePolicy string
+
+const (
+	// MergeNever keeps the tag as is, it is not written even if the file doesn't have it
+	MergeNever MergePolicy = "never"
+	// MergeMissing writes the tag only if the file doesn't have it, e.g. a date set by the camera is kept
+	MergeMissing MergePolicy = "missing"
+	// MergeAlways overwrites the tag
+	MergeAlways MergePolicy = "always"
+)
+
+// tags written by SetExif, a merge policy is set per tag
+const (
+	TagDescription = "description"
+	// TagCreated is DateTime, DateTimeOriginal, DateTimeDigitized and their offsets
+	TagCreated  = "created"
+	TagGPS      = "gps"
+	TagTitle    = "title"
+	TagKeywords = "keywords"
+	TagAuthor   = "author"
+	TagUniqueID = "unique_id"
+)
+
+// defaultMergePolicies keep a date and a location set by the camera
+var defaultMergePolicies = map[string]MergePolicy{
+	TagDescription: MergeAlways,
+	TagCreated:     MergeMissing,
+	TagGPS:         MergeMissing,
+	TagTitle:       MergeAlways,
+	TagKeywords:    MergeAlways,
+	TagAuthor:      MergeAlways,
+	TagUniqueID:    MergeAlways,
+}
+
+// ParseMergePolicies parses policies like "created=always,gps=never", tags which are not listed keep default policies
+func ParseMergePolicies(s string) (map[string]MergePolicy, error) {
+	policies := map[string]MergePolicy{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		tag, name, ok := strings.Cut(item, "=")
+		tag, policy := strings.TrimSpace(tag), MergePolicy(strings.TrimSpace(name))
+		if _, known := defaultMergePolicies[tag]; !ok || !known {
+			return nil, fmt.Errorf("merge policy %q is invalid, it is <tag>=<policy>, tags are %s", item, strings.Join(mergeTags(), ", "))
+		}
+		switch policy {
+		case MergeNever, MergeMissing, MergeAlways:
+			policies[tag] = policy
+		default:
+			return nil, fmt.Errorf("merge policy %q is unknown, it is one of %s, %s, %s", policy, MergeNever, MergeMissing, MergeAlways)
+		}
+	}
+	return policies, nil
+}
+
+// mergeTags returns names of tags which have merge policies
+func mergeTags() []string {
+	tags := make([]string, 0, len(defaultMergePolicies))
+	for tag := range defaultMergePolicies {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// WithMergePolicies sets merge policies of tags, other tags keep default policies
+func WithMergePolicies(policies map[string]MergePolicy) Option {
+	return func(s *SimpleStorage) {
+		s.merge = policies
+	}
+}
+
+// mergePolicy returns a policy of the tag
+func (s *SimpleStorage) mergePolicy(tag string) MergePolicy {
+	if policy, ok := s.merge[tag]; ok {
+		return policy
+	}
+	return defaultMergePolicies[tag]
+}
+
+// shouldWrite tells whether the tag is written by the policy, exists tells whether the file has it
+func (p MergePolicy) shouldWrite(exists bool) bool {
+	return p == MergeAlways || (p == MergeMissing && !exists)
+}
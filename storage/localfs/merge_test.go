@@ -0,0 +1,41 @@
+package localfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMergePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]MergePolicy
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: map[string]MergePolicy{}},
+		{name: "policies", s: "created=always, gps=never,", want: map[string]MergePolicy{TagCreated: MergeAlways, TagGPS: MergeNever}},
+		{name: "unknown tag", s: "make=always", wantErr: true},
+		{name: "unknown policy", s: "created=sometimes", wantErr: true},
+		{name: "no policy", s: "created", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMergePolicies(tt.s)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSimpleStorage_mergePolicy(t *testing.T) {
+	s := NewWithOptions(WithMergePolicies(map[string]MergePolicy{TagCreated: MergeAlways})).(*SimpleStorage)
+	assert.Equal(t, MergeAlways, s.mergePolicy(TagCreated))
+	assert.Equal(t, MergeMissing, s.mergePolicy(TagGPS))
+	assert.Equal(t, MergeAlways, s.mergePolicy(TagDescription))
+
+	assert.True(t, MergeAlways.shouldWrite(true))
+	assert.True(t, MergeMissing.shouldWrite(false))
+	assert.False(t, MergeMissing.shouldWrite(true))
+	assert.False(t, MergeNever.shouldWrite(false))
+}
@@ -0,0 +1,107 @@
+package localfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxRetryDelay = time.Minute
+
+// Option configures SimpleStorage
+type Option func(*SimpleStorage)
+
+// WithRetries sets a number of retries of a failed download, delay is doubled after every attempt
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(s *SimpleStorage) {
+		s.retries = retries
+		s.retryDelay = delay
+	}
+}
+
+// statusError is returned if a photo is responded with non 200 code
+type statusError struct {
+	url        string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%q is unavailable. code is %d", e.url, e.code)
+}
+
+func newStatusError(url string, resp *http.Response) *statusError {
+	return &statusError{url: url, code: resp.StatusCode, retryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+}
+
+// retryAfter parses Retry-After header which is either seconds or http date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// retryable reports whether err is transient: network errors, timeouts, 5xx, 408 and 429
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var e *statusError
+	if errors.As(err, &e) {
+		return e.code >= 500 || e.code == http.StatusTooManyRequests || e.code == http.StatusRequestTimeout
+	}
+	// errors of the local file system are not going to disappear
+	var pathErr *fs.PathError
+	return !errors.As(err, &pathErr)
+}
+
+// backoff returns a delay before the next attempt, it grows exponentially with a random jitter.
+// A zero retry delay is kept, so attempts follow each other unless the server asks to wait.
+func (s *SimpleStorage) backoff(attempt int, err error) time.Duration {
+	delay := s.retryDelay << attempt
+	// the shift overflows to zero or a negative delay for large attempts
+	if s.retryDelay > 0 && (delay <= 0 || delay > maxRetryDelay) {
+		delay = maxRetryDelay
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	var e *statusError
+	if errors.As(err, &e) && e.retryAfter > delay {
+		delay = min(e.retryAfter, maxRetryDelay)
+	}
+	return delay
+}
+
+// withRetries calls download until it succeeds, fails with non transient error or retries are exhausted
+func (s *SimpleStorage) withRetries(ctx context.Context, download func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := download()
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.retries || ctx.Err() != nil || !retryable(err) {
+			if attempt > 0 {
+				return fmt.Errorf("%d attempts failed: %w", attempt+1, err)
+			}
+			return err
+		}
+		timer := time.NewTimer(s.backoff(attempt, err))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package localfs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleStorage_DownloadPhotoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int
+		code      int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "recovered",
+			retries:   3,
+			failures:  2,
+			code:      http.StatusServiceUnavailable,
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "too many requests",
+			retries:   1,
+			failures:  1,
+			code:      http.StatusTooManyRequests,
+			wantCalls: 2,
+			wantErr:   false,
+		},
+		{
+			name:      "exhausted",
+			retries:   2,
+			failures:  5,
+			code:      http.StatusBadGateway,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "not found is not retried",
+			retries:   3,
+			failures:  5,
+			code:      http.StatusNotFound,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= int32(tt.failures) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.code)
+					return
+				}
+				w.Write([]byte("photo"))
+			}))
+			defer server.Close()
+
+			s := NewWithOptions(WithRetries(tt.retries, time.Millisecond)).(*SimpleStorage)
+			file, err := s.DownloadPhoto(context.Background(), server.URL+"/photo.jpg", filepath.Join(t.TempDir(), "photo.jpg"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls))
+			if !tt.wantErr {
+				assert.Equal(t, int64(5), file.Size)
+				content, _ := os.ReadFile(file.Path)
+				assert.Equal(t, "photo", string(content))
+			}
+		})
+	}
+}
+
+func TestSimpleStorage_DownloadPhotoCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s := NewWithOptions(WithRetries(5, time.Second))
+	_, err := s.DownloadPhoto(ctx, server.URL+"/photo.jpg", filepath.Join(t.TempDir(), "photo.jpg"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty", value: "", want: 0},
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "garbage", value: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryAfter(tt.value))
+		})
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, float64(time.Hour), float64(retryAfter(date)), float64(2*time.Second))
+}
+
+func Test_retryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "5xx", err: &statusError{code: http.StatusInternalServerError}, want: true},
+		{name: "429", err: &statusError{code: http.StatusTooManyRequests}, want: true},
+		{name: "403", err: &statusError{code: http.StatusForbidden}, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "file system", err: &os.PathError{Op: "open", Path: "/", Err: errors.New("denied")}, want: false},
+		{name: "network", err: errors.New("connection reset by peer"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryable(tt.err))
+		})
+	}
+}
+
+func TestSimpleStorage_backoff(t *testing.T) {
+	s := &SimpleStorage{retryDelay: time.Second}
+	for attempt := 0; attempt < 3; attempt++ {
+		delay := s.backoff(attempt, errors.New("error"))
+		limit := time.Second << attempt
+		assert.GreaterOrEqual(t, delay, limit/2)
+		assert.LessOrEqual(t, delay, limit)
+	}
+	assert.LessOrEqual(t, s.backoff(100, errors.New("error")), maxRetryDelay)
+	assert.Equal(t, maxRetryDelay, s.backoff(0, &statusError{retryAfter: time.Hour}))
+
+	s = &SimpleStorage{}
+	assert.Zero(t, s.backoff(0, errors.New("error")))
+	assert.Zero(t, s.backoff(100, errors.New("error")))
+}
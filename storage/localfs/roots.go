@@ -0,0 +1,124 @@
+package localfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// WithAllowedRoots restricts destinations to dirs within roots, any dir is allowed if roots are empty.
+// Roots are expected to be absolute paths without symlinks, see ParseRoots.
+func WithAllowedRoots(roots []string) Option {
+	return func(s *SimpleStorage) {
+		s.roots = roots
+	}
+}
+
+// ParseRoots returns real absolute paths of dirs of the list separated by os.PathListSeparator,
+// e.g. ~/Pictures:/mnt/photos, dirs may not exist yet
+func ParseRoots(list string) ([]string, error) {
+	roots := []string{}
+	for _, dir := range filepath.SplitList(list) {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			continue
+		}
+		dir, err := expandHome(dir)
+		if err != nil {
+			return nil, err
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		if dir, err = realPath(dir); err != nil {
+			return nil, fmt.Errorf("root %q: %w", dir, err)
+		}
+		roots = append(roots, dir)
+	}
+	return roots, nil
+}
+
+// expandHome replaces ~ at the beginning of dir with the home dir of the user
+func expandHome(dir string) (string, error) {
+	if !strings.HasPrefix(dir, "~") {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, filepath.FromSlash(dir[1:])), nil
+}
+
+// hasDotDot reports whether any element of dir is "..", such dirs are rejected instead of being cleaned
+func hasDotDot(dir string) bool {
+	for _, elem := range strings.FieldsFunc(dir, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLinks limits dangling symlinks followed by realPath
+const maxLinks = 255
+
+// realPath resolves symlinks of the absolute path, elements which don't exist yet are kept as is,
+// a dangling symlink is resolved to its target
+func realPath(path string) (string, error) {
+	missing := []string{}
+	for links := 0; ; {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{real}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if target, err := os.Readlink(path); err == nil {
+			if links++; links > maxLinks {
+				return "", fmt.Errorf("%s: too many links", path)
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			path = target
+			continue
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// within reports whether path is root or is inside of it
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// allowedDir returns an absolute path of dir, relative dirs are within the first root. Symlinks are resolved
+// before the check, so a link within a root can't point outside of it.
+func (s *SimpleStorage) allowedDir(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.roots[0], dir)
+	}
+	dir = filepath.Clean(dir)
+	real, err := realPath(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range s.roots {
+		if within(real, root) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", dir, sources.ErrDirNotAllowed)
+}
@@ -0,0 +1,85 @@
+package localfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRoots(t *testing.T) {
+	dir := t.TempDir()
+	real, err := filepath.EvalSymlinks(dir)
+	assert.NoError(t, err)
+	home, err := os.UserHomeDir()
+	assert.NoError(t, err)
+	home, err = filepath.EvalSymlinks(home)
+	assert.NoError(t, err)
+	link := filepath.Join(dir, "link")
+	assert.NoError(t, os.Symlink(real, link))
+
+	roots, err := ParseRoots(strings.Join([]string{"~", filepath.Join(dir, "new"), "", link}, string(filepath.ListSeparator)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{home, filepath.Join(real, "new"), real}, roots)
+
+	roots, err = ParseRoots("")
+	assert.NoError(t, err)
+	assert.Empty(t, roots)
+}
+
+func TestSimpleStorage_DirPathRoots(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	assert.NoError(t, os.MkdirAll(root, 0750))
+	assert.NoError(t, os.MkdirAll(outside, 0750))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "photos"), filepath.Join(dir, "inside")))
+	roots, err := ParseRoots(root)
+	assert.NoError(t, err)
+	s := &SimpleStorage{roots: roots}
+
+	tests := []struct {
+		name    string
+		dir     string
+		want    string
+		wantErr error
+	}{
+		{name: "root", dir: root, want: root},
+		{name: "new dir", dir: filepath.Join(root, "photos", "2021"), want: filepath.Join(root, "photos", "2021")},
+		{name: "relative", dir: "photos", want: filepath.Join(root, "photos")},
+		{name: "outside", dir: outside, wantErr: sources.ErrDirNotAllowed},
+		{name: "sibling with the same prefix", dir: root + "2", wantErr: sources.ErrDirNotAllowed},
+		{name: "traversal", dir: root + "/../outside", wantErr: sources.ErrDirInvalid},
+		{name: "relative traversal", dir: "../outside", wantErr: sources.ErrDirInvalid},
+		{name: "symlink escape", dir: filepath.Join(root, "escape", "photos"), wantErr: sources.ErrDirNotAllowed},
+		{name: "symlink into root", dir: filepath.Join(dir, "inside"), want: filepath.Join(dir, "inside")},
+		{name: "empty", dir: "", wantErr: sources.ErrDirInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DirPath(tt.dir)
+			assert.True(t, errors.Is(err, tt.wantErr), err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSimpleStorage_PrepareRoots(t *testing.T) {
+	dir := t.TempDir()
+	roots, err := ParseRoots(filepath.Join(dir, "root"))
+	assert.NoError(t, err)
+	s := NewWithOptions(WithAllowedRoots(roots))
+
+	_, err = s.Prepare(filepath.Join(dir, "outside"))
+	assert.ErrorIs(t, err, sources.ErrDirNotAllowed)
+	assert.NoDirExists(t, filepath.Join(dir, "outside"))
+
+	got, err := s.Prepare("photos")
+	assert.NoError(t, err)
+	assert.DirExists(t, got)
+}
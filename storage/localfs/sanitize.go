@@ -0,0 +1,155 @@
+package localfs
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// maxNameLen is a max length of a sanitized name in bytes, most file systems allow 255 bytes,
+	// the rest is left for suffixes of albums with the same name
+	maxNameLen = 200
+	// maxExtLen is a max length of an extension which is kept when a long name is cut
+	maxExtLen = 16
+	// emptyName replaces names which are empty after sanitizing
+	emptyName = "_"
+	// maxPathLen is a max length of a path in UTF-16 units, longer paths can't be opened on Windows
+	// as MAX_PATH is 260 with the terminating NUL
+	maxPathLen = 259
+	// pathReserve is left for suffixes of claimed names, e.g. "_2", and for names of temporary files
+	pathReserve = 24
+	// minNameLen is a length in UTF-16 units components are not shortened below to fit maxPathLen
+	minNameLen = 32
+)
+
+// albumSuffix matches the suffix given to a dir of an album with a taken name, see albumMap.dir
+var albumSuffix = regexp.MustCompile(` \([^()]*\)( \d+)?$`)
+
+// reservedNames can't be used as file names on Windows, with any extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName makes name a single path component which is valid on Linux, macOS, Windows and exFAT:
+// unicode is normalized to NFC, separators, reserved and control characters are replaced with "_",
+// leading spaces and trailing dots and spaces are trimmed, reserved names of Windows get "_" appended
+// and the name is cut to maxNameLen bytes keeping its extension.
+func sanitizeName(name string) string {
+	name = norm.NFC.String(name)
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = trimName(name)
+	if len(name) > maxNameLen {
+		ext := filepath.Ext(name)
+		if len(ext) > maxExtLen {
+			ext = ""
+		}
+		name = trimName(cut(strings.TrimSuffix(name, ext), maxNameLen-len(ext))) + ext
+	}
+	if name == "" || strings.Trim(name, ".") == "" {
+		return emptyName
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_" + strings.TrimPrefix(name, base)
+	}
+	return name
+}
+
+// trimName trims leading spaces and trailing dots and spaces, Windows drops the trailing ones silently
+func trimName(name string) string {
+	return strings.TrimRight(strings.TrimLeftFunc(name, unicode.IsSpace), ". ")
+}
+
+// cut cuts s to n bytes at most without breaking a rune
+func cut(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// units returns a length of s in UTF-16 units, Windows limits paths by them
+func units(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeUnits(r)
+	}
+	return n
+}
+
+// runeUnits returns 2 for a rune which is encoded as a surrogate pair, otherwise 1
+func runeUnits(r rune) int {
+	if r1, _ := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+		return 2
+	}
+	return 1
+}
+
+// cutUnits cuts s to n UTF-16 units at most without breaking a rune
+func cutUnits(s string, n int) string {
+	for i, r := range s {
+		if n -= runeUnits(r); n < 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// shortenName cuts the sanitized name to n UTF-16 units keeping its tail: the extension of a file
+// or the suffix of an album dir
+func shortenName(name string, n int, file bool) string {
+	tail := albumSuffix.FindString(name)
+	if file {
+		if tail = filepath.Ext(name); len(tail) > maxExtLen {
+			tail = ""
+		}
+	}
+	if units(tail) >= n {
+		tail = ""
+	}
+	return sanitizeName(trimName(cutUnits(strings.TrimSuffix(name, tail), n-units(tail))) + tail)
+}
+
+// fitPath shortens the components marked as shortenable, the longest ones first, so the path joined of them
+// fits limit UTF-16 units. Components are not shortened below minNameLen, so the path may stay longer.
+func fitPath(components []string, shortenable []bool, limit int) {
+	excess := units(filepath.Join(components...)) - limit
+	order := []int{}
+	for i := range components {
+		if shortenable[i] {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, k int) bool {
+		return units(components[order[i]]) > units(components[order[k]])
+	})
+	for _, i := range order {
+		if excess <= 0 {
+			return
+		}
+		length := units(components[i])
+		if length <= minNameLen {
+			continue
+		}
+		shortened := shortenName(components[i], max(length-excess, minNameLen), i == len(components)-1)
+		excess -= length - units(shortened)
+		components[i] = shortened
+	}
+}
@@ -0,0 +1,68 @@
+package localfs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "Разное", want: "Разное"},
+		{name: "nfc", in: "\u0418\u0306ога", want: "Йога"},
+		{name: "slash", in: "2022/08 Sea", want: "2022_08 Sea"},
+		{name: "backslash", in: `a\b`, want: "a_b"},
+		{name: "parent dir", in: "..", want: "_"},
+		{name: "current dir", in: ".", want: "_"},
+		{name: "empty", in: "", want: "_"},
+		{name: "spaces", in: "   ", want: "_"},
+		{name: "parent dir with slash", in: "../../etc", want: ".._.._etc"},
+		{name: "reserved characters", in: `a<b>c:d"e|f?g*h`, want: "a_b_c_d_e_f_g_h"},
+		{name: "control characters", in: "a\tb\nc\x00d", want: "a_b_c_d"},
+		{name: "trailing dots and spaces", in: " Summer... ", want: "Summer"},
+		{name: "reserved name", in: "con", want: "con_"},
+		{name: "reserved name with ext", in: "LPT1.jpg", want: "LPT1_.jpg"},
+		{name: "not reserved", in: "CONCERT", want: "CONCERT"},
+		{name: "invalid utf8", in: "a\xffb", want: "a_b"},
+		{name: "long name keeps ext", in: strings.Repeat("a", 300) + ".jpg", want: strings.Repeat("a", maxNameLen-4) + ".jpg"},
+		{name: "long name cuts runes", in: strings.Repeat("я", 150), want: strings.Repeat("я", maxNameLen/2)},
+		{name: "long ext", in: strings.Repeat("a", 300) + "." + strings.Repeat("b", 20), want: strings.Repeat("a", maxNameLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeName(tt.in)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, len(got), maxNameLen)
+			assert.Equal(t, got, sanitizeName(got))
+		})
+	}
+}
+
+func TestSimpleStorage_PreparePhotoSanitized(t *testing.T) {
+	rootDir := t.TempDir()
+	tests := []struct {
+		name  string
+		album sources.Album
+		want  string
+	}{
+		{name: "slash", album: sources.Album{Source: "vk", ID: "1", Name: "a/b"}, want: "a_b"},
+		{name: "escape", album: sources.Album{Source: "vk", ID: "2", Name: ".."}, want: "_"},
+		{name: "empty", album: sources.Album{Source: "vk", ID: "3", Name: "  "}, want: "3"},
+		{name: "same sanitized name", album: sources.Album{Source: "vk", ID: "4", Name: "a:b"}, want: "a_b (4)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&SimpleStorage{}).PreparePhoto(rootDir, tt.album, &photoItem{id: "1", url: "https://example.com/1.jpg"})
+			assert.NoError(t, err)
+			assert.Equal(t, rootDir+"/"+tt.want+"/1.jpg", got)
+			assert.DirExists(t, filepath.Dir(got))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+)
+
+// sidecarExt is appended to a name of a file to get a name of its sidecar, e.g. 1.jpg.xmp,
+// darktable and digiKam look for sidecars named so
+const sidecarExt = ".xmp"
+
+// WithSidecars makes the storage write XMP sidecars next to saved files
+func WithSidecars(enabled bool) Option {
+	return func(s *SimpleStorage) {
+		s.sidecars = enabled
+	}
+}
+
+var sidecarTemplate = template.Must(template.New("xmp").Funcs(template.FuncMap{
+	"xml": xmlEscape,
+	"lat": func(v float64) string { return xmpCoordinate(v, "N", "S") },
+	"lon": func(v float64) string { return xmpCoordinate(v, "E", "W") },
+}).Parse(`<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="photoDumper">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:photoDumper="https://github.com/Gasoid/photoDumper/xmp/1.0/"
+{{- if .Created}}
+    xmp:CreateDate="{{.Created}}"
+    exif:DateTimeOriginal="{{.Created}}"
+    photoshop:DateCreated="{{.Created}}"
+{{- end}}
+{{- if .GPS}}
+    exif:GPSLatitude="{{lat (index .GPS 0)}}"
+    exif:GPSLongitude="{{lon (index .GPS 1)}}"
+{{- end}}
+    dc:source="{{xml .URL}}"
+    photoDumper:Source="{{xml .Source}}"
+    photoDumper:PhotoID="{{xml .PhotoID}}"
+    photoDumper:Album="{{xml .Album}}">
+{{- if .Title}}
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">{{xml .Title}}</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+{{- end}}
+{{- if .Author}}
+   <dc:creator>
+    <rdf:Seq>
+     <rdf:li>{{xml .Author}}</rdf:li>
+    </rdf:Seq>
+   </dc:creator>
+{{- end}}
+{{- if .Description}}
+   <dc:description>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">{{xml .Description}}</rdf:li>
+    </rdf:Alt>
+   </dc:description>
+{{- end}}
+{{- if .Subjects}}
+   <dc:subject>
+    <rdf:Bag>
+{{- range .Subjects}}
+     <rdf:li>{{xml .}}</rdf:li>
+{{- end}}
+    </rdf:Bag>
+   </dc:subject>
+{{- end}}
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`))
+
+func xmlEscape(s string) (string, error) {
+	var b bytes.Buffer
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// xmpCoordinate formats a coordinate as XMP GPSCoordinate "DDD,MM.mmmmmmK"
+func xmpCoordinate(v float64, positive, negative string) string {
+	ref := positive
+	if v < 0 {
+		ref = negative
+		v = -v
+	}
+	degrees := math.Floor(v)
+	return fmt.Sprintf("%d,%.6f%s", int(degrees), (v-degrees)*60, ref)
+}
+
+// WriteSidecar writes an XMP sidecar with the metadata next to the file, it does nothing if sidecars are off
+// unless fallback is set
+func (s *SimpleStorage) WriteSidecar(path string, meta sources.Metadata, fallback bool) error {
+	if !s.sidecars && !fallback {
+		return nil
+	}
+	data := struct {
+		sources.Metadata
+		Created string
+		GPS     []float64
+		// Subjects are the album and the keywords
+		Subjects []string
+	}{Metadata: meta}
+	if !meta.Created.IsZero() {
+		data.Created = meta.Created.Format(time.RFC3339)
+	}
+	if len(meta.GPS) >= 2 {
+		data.GPS = meta.GPS
+	}
+	for _, subject := range append([]string{meta.Album}, meta.Keywords...) {
+		if subject != "" && !slices.Contains(data.Subjects, subject) {
+			data.Subjects = append(data.Subjects, subject)
+		}
+	}
+	var b bytes.Buffer
+	if err := sidecarTemplate.Execute(&b, data); err != nil {
+		return fmt.Errorf("WriteSidecar: %w", err)
+	}
+	if err := writeFileAtomic(path+sidecarExt, b.Bytes()); err != nil {
+		return fmt.Errorf("WriteSidecar: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package localfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Gasoid/photoDumper/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimpleStorage_WriteSidecar(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     sources.Metadata
+		contains []string
+		excludes []string
+	}{
+		{
+			name: "full",
+			meta: sources.Metadata{
+				Source:      "vk",
+				PhotoID:     "1_2",
+				URL:         "https://example.com/1.jpg?a=1&b=2",
+				Album:       `Sea & "Sun"`,
+				Description: "Dumped by <photoDumper>",
+				Created:     time.Date(2021, 7, 9, 10, 0, 0, 0, time.UTC),
+				GPS:         []float64{55.7558, -37.6173},
+				Title:       "Sea",
+				Keywords:    []string{`Sea & "Sun"`, "beach"},
+				Author:      "id1",
+			},
+			contains: []string{
+				`xmp:CreateDate="2021-07-09T10:00:00Z"`,
+				`exif:DateTimeOriginal="2021-07-09T10:00:00Z"`,
+				`exif:GPSLatitude="55,45.348000N"`,
+				`exif:GPSLongitude="37,37.038000W"`,
+				`dc:source="https://example.com/1.jpg?a=1&amp;b=2"`,
+				`photoDumper:Source="vk"`,
+				`photoDumper:PhotoID="1_2"`,
+				`photoDumper:Album="Sea &amp; &#34;Sun&#34;"`,
+				`<rdf:li xml:lang="x-default">Dumped by &lt;photoDumper&gt;</rdf:li>`,
+				`<rdf:li xml:lang="x-default">Sea</rdf:li>`,
+				"<rdf:Seq>\n     <rdf:li>id1</rdf:li>",
+				// the album is a keyword already, it is not repeated
+				"<rdf:Bag>\n     <rdf:li>Sea &amp; &#34;Sun&#34;</rdf:li>\n     <rdf:li>beach</rdf:li>\n    </rdf:Bag>",
+			},
+		},
+		{
+			name:     "no exif",
+			meta:     sources.Metadata{Source: "instagram", PhotoID: "3", URL: "https://example.com/3.mp4"},
+			contains: []string{`photoDumper:Source="instagram"`, `dc:source="https://example.com/3.mp4"`},
+			excludes: []string{"CreateDate", "GPSLatitude", "dc:description", "dc:subject", "dc:title", "dc:creator"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "1.jpg")
+			s := NewWithOptions(WithSidecars(true))
+			assert.NoError(t, s.WriteSidecar(path, tt.meta, false))
+
+			data, err := os.ReadFile(path + sidecarExt)
+			assert.NoError(t, err)
+			for _, want := range tt.contains {
+				assert.Contains(t, string(data), want)
+			}
+			for _, exclude := range tt.excludes {
+				assert.NotContains(t, string(data), exclude)
+			}
+			// the sidecar is well formed xml
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				_, err := decoder.Token()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				if err != nil {
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSimpleStorage_WriteSidecarOff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.jpg")
+	assert.NoError(t, (&SimpleStorage{}).WriteSidecar(path, sources.Metadata{Source: "vk"}, false))
+	assert.NoFileExists(t, path+sidecarExt)
+	assert.NoError(t, (&SimpleStorage{}).WriteSidecar(path, sources.Metadata{Source: "vk"}, true))
+	assert.FileExists(t, path+sidecarExt)
+	assert.Error(t, NewWithOptions(WithSidecars(true)).WriteSidecar(filepath.Join(path, "nonExistent", "1.jpg"), sources.Metadata{}, false))
+}
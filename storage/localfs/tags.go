@@ -0,0 +1,233 @@
+package localfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Gasoid/photoDumper/sources"
+	exif "github.com/dsoprea/go-exif/v2"
+	exifcommon "github.com/dsoprea/go-exif/v2/common"
+)
+
+// exif tags which are not in the tag index of go-exif, they are set as raw values
+const (
+	tagOffsetTime          = 0x9010
+	tagOffsetTimeOriginal  = 0x9011
+	tagOffsetTimeDigitized = 0x9012
+)
+
+// paths of child ifds, the root ifd is IFD0
+const (
+	exifIfdPath = "IFD/Exif"
+	gpsIfdPath  = "IFD/GPSInfo"
+)
+
+// exifDateTime is a format of dates in exif, exifOffset is a format of their timezones
+const (
+	exifDateTime = "2006:01:02 15:04:05"
+	exifOffset   = "-07:00"
+)
+
+// ucs2 encodes s as XP tags want it, little endian UTF-16 with a terminator
+func ucs2(s string) []byte {
+	value := []byte{}
+	for _, c := range utf16.Encode([]rune(s)) {
+		value = binary.LittleEndian.AppendUint16(value, c)
+	}
+	return append(value, 0, 0)
+}
+
+// details returns details of the info, they are empty if the source doesn't know them
+func details(info sources.ExifInfo) sources.ExifDetails {
+	if d, ok := info.(sources.ExifDetails); ok {
+		return d
+	}
+	return noDetails{}
+}
+
+type noDetails struct{}
+
+func (noDetails) Title() string      { return "" }
+func (noDetails) Keywords() []string { return nil }
+func (noDetails) Author() string     { return "" }
+func (noDetails) UniqueID() string   { return "" }
+
+// newExifBuilder returns a builder of IFD0 with tags of existing, a tiff structure of the file,
+// it is empty if existing is nil
+func newExifBuilder(existing []byte) (root *exif.IfdBuilder, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = fmt.Errorf("exif is corrupted: %v", state)
+		}
+	}()
+	im := exif.NewIfdMappingWithStandard()
+	ti := exif.NewTagIndex()
+	if err := exif.LoadStandardTags(ti); err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return exif.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, exifcommon.EncodeDefaultByteOrder), nil
+	}
+	_, index, err := exif.Collect(im, ti, existing)
+	if err != nil {
+		return nil, err
+	}
+	return exif.NewIfdBuilderFromExistingChain(index.RootIfd), nil
+}
+
+// exifPayload returns a tiff structure of existing tags merged with the info, it is a payload of exif chunks
+// of png and webp
+func (s *SimpleStorage) exifPayload(existing []byte, info sources.ExifInfo) ([]byte, error) {
+	root, err := newExifBuilder(existing)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.setTags(root, info); err != nil {
+		return nil, err
+	}
+	return exif.NewIfdByteEncoder().EncodeToExif(root)
+}
+
+// hasTag reports whether the ifd at path has the tag, path is "" for the root ifd
+func hasTag(root *exif.IfdBuilder, path, name string) bool {
+	ib := root
+	if path != "" {
+		var err error
+		ib, err = root.ChildWithTagId(map[string]uint16{exifIfdPath: exifcommon.IfdExifStandardIfdIdentity.TagId(), gpsIfdPath: exifcommon.IfdGpsInfoStandardIfdIdentity.TagId()}[path])
+		if err != nil {
+			return false
+		}
+	}
+	_, err := ib.FindTagWithName(name)
+	return err == nil
+}
+
+// setTags sets tags of the info to the root ifd according to merge policies, it returns tags which are written
+func (s *SimpleStorage) setTags(root *exif.IfdBuilder, info sources.ExifInfo) (map[string]bool, error) {
+	d := details(info)
+	created, gps := info.Created(), info.GPS()
+	tags := []struct {
+		tag string
+		// known tells whether the info has the tag, exists tells whether the file has it
+		known, exists bool
+		set           func() error
+	}{
+		{
+			tag: TagDescription, known: info.Description() != "", exists: hasTag(root, "", "ImageDescription"),
+			set: func() error { return root.SetStandardWithName("ImageDescription", info.Description()) },
+		},
+		{
+			tag: TagCreated, known: !created.IsZero(), exists: hasTag(root, "", "DateTime") || hasTag(root, exifIfdPath, "DateTimeOriginal"),
+			set: func() error { return setCreated(root, created) },
+		},
+		{
+			tag: TagGPS, known: sources.HasLocation(gps), exists: hasTag(root, gpsIfdPath, "GPSLatitude"),
+			set: func() error { return setGPS(root, gps) },
+		},
+		{
+			tag: TagTitle, known: d.Title() != "", exists: hasTag(root, "", "XPTitle"),
+			set: func() error { return root.SetStandardWithName("XPTitle", ucs2(d.Title())) },
+		},
+		{
+			tag: TagKeywords, known: len(d.Keywords()) > 0, exists: hasTag(root, "", "XPKeywords"),
+			set: func() error { return root.SetStandardWithName("XPKeywords", ucs2(strings.Join(d.Keywords(), ";"))) },
+		},
+		{
+			tag: TagAuthor, known: d.Author() != "", exists: hasTag(root, "", "Artist"),
+			set: func() error { return root.SetStandardWithName("Artist", d.Author()) },
+		},
+		{
+			tag: TagUniqueID, known: d.UniqueID() != "", exists: hasTag(root, exifIfdPath, "ImageUniqueID"),
+			set: func() error {
+				exifIb, err := exif.GetOrCreateIbFromRootIb(root, exifIfdPath)
+				if err != nil {
+					return err
+				}
+				return exifIb.SetStandardWithName("ImageUniqueID", d.UniqueID())
+			},
+		},
+	}
+	written := map[string]bool{}
+	for _, t := range tags {
+		if !t.known || !s.mergePolicy(t.tag).shouldWrite(t.exists) {
+			continue
+		}
+		if err := t.set(); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.tag, err)
+		}
+		written[t.tag] = true
+	}
+	return written, nil
+}
+
+// setCreated sets dates of creation in the timezone of created
+func setCreated(root *exif.IfdBuilder, created time.Time) error {
+	date := created.Format(exifDateTime)
+	if err := root.SetStandardWithName("DateTime", date); err != nil {
+		return err
+	}
+	exifIb, err := exif.GetOrCreateIbFromRootIb(root, exifIfdPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"DateTimeOriginal", "DateTimeDigitized"} {
+		if err := exifIb.SetStandardWithName(name, date); err != nil {
+			return err
+		}
+	}
+	offset := exif.NewIfdBuilderTagValueFromBytes(append([]byte(created.Format(exifOffset)), 0))
+	for _, tag := range []uint16{tagOffsetTime, tagOffsetTimeOriginal, tagOffsetTimeDigitized} {
+		bt := exif.NewBuilderTag(exifIfdPath, tag, exifcommon.TypeAscii, offset, exifcommon.EncodeDefaultByteOrder)
+		if err := exifIb.Set(bt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setGPS sets latitude and longitude with their references
+func setGPS(root *exif.IfdBuilder, gps []float64) error {
+	gpsIb, err := exif.GetOrCreateIbFromRootIb(root, gpsIfdPath)
+	if err != nil {
+		return err
+	}
+	ref := func(v float64, positive, negative string) string {
+		if v < 0 {
+			return negative
+		}
+		return positive
+	}
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"GPSVersionID", []byte{2, 3, 0, 0}},
+		{"GPSLatitudeRef", ref(gps[0], "N", "S")},
+		{"GPSLatitude", coordinate(gps[0])},
+		{"GPSLongitudeRef", ref(gps[1], "E", "W")},
+		{"GPSLongitude", coordinate(gps[1])},
+	}
+	for _, v := range values {
+		if err := gpsIb.SetStandardWithName(v.name, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coordinate returns degrees, minutes and seconds of the coordinate
+func coordinate(v float64) []exifcommon.Rational {
+	v = math.Abs(v)
+	degrees := math.Floor(v)
+	minutes := math.Floor((v - degrees) * 60)
+	seconds := (v - degrees - minutes/60) * 3600
+	return []exifcommon.Rational{
+		{Numerator: uint32(degrees), Denominator: 1},
+		{Numerator: uint32(minutes), Denominator: 1},
+		{Numerator: uint32(math.Round(seconds * 10000)), Denominator: 10000},
+	}
+}
@@ -0,0 +1,116 @@
+package localfs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	exif "github.com/dsoprea/go-exif/v2"
+	exifcommon "github.com/dsoprea/go-exif/v2/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// exifTags returns values of tags of the tiff structure by "<ifd path>/<tag name>",
+// tags which are unknown to go-exif are named by their IDs
+func exifTags(t *testing.T, raw []byte) map[string]interface{} {
+	t.Helper()
+	entries, err := exif.GetFlatExifData(raw)
+	assert.NoError(t, err)
+	tags := map[string]interface{}{}
+	for _, entry := range entries {
+		name := entry.TagName
+		if name == "" {
+			name = fmt.Sprintf("0x%04x", entry.TagId)
+		}
+		tags[entry.IfdPath+"/"+name] = entry.Value
+	}
+	return tags
+}
+
+func TestSimpleStorage_exifPayload(t *testing.T) {
+	created := time.Date(2021, 7, 9, 10, 11, 12, 0, time.FixedZone("", -5*60*60))
+	info := &detailedExif{
+		ExifInfo: ExifInfo{description: "Kazan", created: created, gps: []float64{-55.5, 49.125}},
+		title:    "Sea",
+		keywords: []string{"Summer", "beach"},
+		author:   "id1",
+		uniqueID: "1_2",
+	}
+	data, err := (&SimpleStorage{}).exifPayload(nil, info)
+	assert.NoError(t, err)
+
+	tags := exifTags(t, data)
+	assert.Equal(t, "Kazan", tags["IFD/ImageDescription"])
+	assert.Equal(t, "2021:07:09 10:11:12", tags["IFD/DateTime"])
+	assert.Equal(t, "2021:07:09 10:11:12", tags["IFD/Exif/DateTimeOriginal"])
+	assert.Equal(t, "2021:07:09 10:11:12", tags["IFD/Exif/DateTimeDigitized"])
+	for _, tag := range []uint16{tagOffsetTime, tagOffsetTimeOriginal, tagOffsetTimeDigitized} {
+		assert.Equal(t, "-05:00", tags[fmt.Sprintf("IFD/Exif/0x%04x", tag)])
+	}
+	assert.Equal(t, "id1", tags["IFD/Artist"])
+	assert.Equal(t, ucs2("Sea"), tags["IFD/XPTitle"])
+	assert.Equal(t, ucs2("Summer;beach"), tags["IFD/XPKeywords"])
+	assert.Equal(t, "1_2", tags["IFD/Exif/ImageUniqueID"])
+	assert.Equal(t, "S", tags["IFD/GPSInfo/GPSLatitudeRef"])
+	assert.Equal(t, "E", tags["IFD/GPSInfo/GPSLongitudeRef"])
+	assert.Equal(t, []exifcommon.Rational{{Numerator: 55, Denominator: 1}, {Numerator: 30, Denominator: 1}, {Numerator: 0, Denominator: 10000}}, tags["IFD/GPSInfo/GPSLatitude"])
+	assert.Equal(t, []exifcommon.Rational{{Numerator: 49, Denominator: 1}, {Numerator: 7, Denominator: 1}, {Numerator: 300000, Denominator: 10000}}, tags["IFD/GPSInfo/GPSLongitude"])
+}
+
+func TestSimpleStorage_exifPayloadMerge(t *testing.T) {
+	camera := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	// a file of the camera has its date, location and make
+	root, err := newExifBuilder(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, root.SetStandardWithName("Make", "Canon"))
+	_, err = NewWithOptions(WithMergePolicies(map[string]MergePolicy{TagDescription: MergeNever})).(*SimpleStorage).setTags(root, &ExifInfo{created: camera, gps: []float64{1, 2}})
+	assert.NoError(t, err)
+	existing, err := exif.NewIfdByteEncoder().EncodeToExif(root)
+	assert.NoError(t, err)
+
+	info := &ExifInfo{description: "Kazan", created: time.Date(2021, 7, 9, 10, 11, 12, 0, time.UTC), gps: []float64{55.5, 49.125}}
+	tests := []struct {
+		name            string
+		policies        map[string]MergePolicy
+		info            *ExifInfo
+		wantDate        string
+		wantLatitudeRef string
+		wantLatitude    uint32
+		wantDescription interface{}
+	}{
+		{name: "default", wantDate: "2020:01:02 03:04:05", wantLatitude: 1, wantDescription: "Kazan"},
+		{
+			name:     "always",
+			policies: map[string]MergePolicy{TagCreated: MergeAlways, TagGPS: MergeAlways},
+			wantDate: "2021:07:09 10:11:12", wantLatitude: 55, wantDescription: "Kazan",
+		},
+		{name: "never", policies: map[string]MergePolicy{TagDescription: MergeNever}, wantDate: "2020:01:02 03:04:05", wantLatitude: 1},
+		{
+			name:     "no location",
+			policies: map[string]MergePolicy{TagGPS: MergeAlways},
+			info:     &ExifInfo{gps: []float64{0, 0}},
+			wantDate: "2020:01:02 03:04:05", wantLatitude: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWithOptions(WithMergePolicies(tt.policies)).(*SimpleStorage)
+			merged := info
+			if tt.info != nil {
+				merged = tt.info
+			}
+			data, err := s.exifPayload(existing, merged)
+			assert.NoError(t, err)
+			tags := exifTags(t, data)
+			assert.Equal(t, "Canon", tags["IFD/Make"])
+			assert.Equal(t, tt.wantDate, tags["IFD/Exif/DateTimeOriginal"])
+			assert.Equal(t, tt.wantLatitude, tags["IFD/GPSInfo/GPSLatitude"].([]exifcommon.Rational)[0].Numerator)
+			assert.Equal(t, tt.wantDescription, tags["IFD/ImageDescription"])
+		})
+	}
+}
+
+func TestSimpleStorage_exifPayloadCorrupted(t *testing.T) {
+	_, err := (&SimpleStorage{}).exifPayload([]byte("II*\x00\xff\xff\xff\xff"), &ExifInfo{description: "a"})
+	assert.Error(t, err)
+}